@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var defaultAccept = flag.String("default-accept", "", "negotiate content types as if clients sending no Accept header, or only */*, sent `value`")
+
+type mediaRange struct {
+	mediaType string
+	quality   float64
+}
+
+func parseAccept(header string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			quality, err = strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+		}
+
+		ranges = append(ranges, mediaRange{mediaType, quality})
+	}
+
+	return ranges
+}
+
+// quality returns the quality of mediaType given by the most specific of
+// the ranges matching it, or 0 if none does.
+func quality(ranges []mediaRange, mediaType string) float64 {
+	major, _, _ := strings.Cut(mediaType, "/")
+
+	best := -1
+	q := 0.0
+	for _, r := range ranges {
+		specificity := -1
+		switch {
+		case r.mediaType == mediaType:
+			specificity = 2
+		case r.mediaType == major+"/*":
+			specificity = 1
+		case r.mediaType == "*/*":
+			specificity = 0
+		}
+		if specificity > best {
+			best = specificity
+			q = r.quality
+		}
+	}
+
+	return q
+}
+
+// acceptHeader returns the Accept header of request, or -default-accept if
+// the client did not express a preference.
+func acceptHeader(request *http.Request) string {
+	accept := strings.TrimSpace(request.Header.Get("Accept"))
+	if *defaultAccept != "" && (accept == "" || accept == "*/*") {
+		return *defaultAccept
+	}
+
+	return accept
+}
+
+// negotiate returns the offered media type the client accepts with the
+// highest quality, preferring earlier offers on ties. It returns "" if
+// the client accepts none of them. Clients without an Accept header accept
+// everything.
+func negotiate(request *http.Request, offered []string) string {
+	accept := acceptHeader(request)
+	if accept == "" {
+		accept = "*/*"
+	}
+	ranges := parseAccept(accept)
+
+	best := ""
+	bestQuality := 0.0
+	for _, mediaType := range offered {
+		if q := quality(ranges, mediaType); q > bestQuality {
+			best = mediaType
+			bestQuality = q
+		}
+	}
+
+	return best
+}
+
+// prefersJSON returns true if the client accepts JSON at least as much as
+// HTML.
+func prefersJSON(request *http.Request) bool {
+	return negotiate(request, []string{"application/json", "text/html"}) == "application/json"
+}
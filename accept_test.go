@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	offered := []string{"application/json", "text/html"}
+	for _, test := range []struct {
+		accept   string
+		expected string
+	}{
+		{"", "application/json"},
+		{"*/*", "application/json"},
+		{"application/json", "application/json"},
+		{"text/html", "text/html"},
+		{"text/html;q=0.1, application/json", "application/json"},
+		{"application/json;q=0.1, text/html", "text/html"},
+		{"text/html, application/xhtml+xml, application/xml;q=0.9, */*;q=0.8", "text/html"},
+		{"text/*, application/json;q=0.5", "text/html"},
+		{"*/*;q=0.1, text/html;q=0.5", "text/html"},
+		{"application/json-patch+json", ""},
+		{"image/png", ""},
+		{"text/html;q=0, */*", "application/json"},
+		{"text/html;q=invalid, application/json;q=0.2", "application/json"},
+	} {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		if test.accept != "" {
+			request.Header.Set("Accept", test.accept)
+		}
+		if got := negotiate(request, offered); got != test.expected {
+			t.Errorf("%q: got %q, expected %q", test.accept, got, test.expected)
+		}
+	}
+}
+
+func TestNegotiateDefaultAccept(t *testing.T) {
+	setFlag(t, "default-accept", "text/html")
+
+	for _, accept := range []string{"", "*/*"} {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set("Accept", accept)
+		if got := negotiate(request, []string{"application/json", "text/html"}); got != "text/html" {
+			t.Errorf("%q: got %q, expected -default-accept", accept, got)
+		}
+	}
+}
+
+func TestIndexAccept(t *testing.T) {
+	startTestService(t)
+	server := startProxy(t)
+
+	for accept, expected := range map[string]string{
+		"text/html;q=0.1, application/json": "application/json; charset=utf-8",
+		"application/json;q=0.1, text/html": "text/html; charset=utf-8",
+		"*/*":                               "text/html; charset=utf-8",
+		"text/*":                            "text/html; charset=utf-8",
+		"application/*":                     "application/json; charset=utf-8",
+	} {
+		request := newRequest(t, http.MethodGet, server.URL+"/", "")
+		request.Header.Set("Accept", accept)
+		response, body := do(t, request)
+		checkStatus(t, response, body, http.StatusOK)
+		if contentType := response.Header.Get("Content-Type"); contentType != expected {
+			t.Errorf("%q: got %q, expected %q", accept, contentType, expected)
+		}
+		if strings.HasPrefix(expected, "application/json") && !strings.Contains(body, `"org.example.test"`) {
+			t.Errorf("%q: interface missing from %s", accept, body)
+		}
+	}
+}
+
+func TestErrorAccept(t *testing.T) {
+	startTestService(t)
+	server := startProxy(t)
+
+	for accept, expected := range map[string]string{
+		"text/html;q=0.1, application/json": "application/json; charset=utf-8",
+		"text/html":                         "text/html; charset=utf-8",
+		"*/*":                               "application/json; charset=utf-8",
+	} {
+		request := newRequest(t, http.MethodGet, server.URL+"/interface/org.example.unknown", "")
+		request.Header.Set("Accept", accept)
+		response, body := do(t, request)
+		checkStatus(t, response, body, http.StatusNotFound)
+		if contentType := response.Header.Get("Content-Type"); contentType != expected {
+			t.Errorf("%q: got %q, expected %q", accept, contentType, expected)
+		}
+	}
+}
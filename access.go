@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"path"
+	"strings"
+
+	"github.com/varlink/go/varlink"
+)
+
+// interfacePatterns is a list of interface name patterns. A pattern matches
+// an interface of the same name and all interfaces below it ("org.example"
+// matches "org.example.foo"), and may contain '*' wildcards.
+type interfacePatterns []string
+
+func parseInterfacePatterns(s string) interfacePatterns {
+	var patterns interfacePatterns
+	for _, pattern := range strings.Split(s, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	return patterns
+}
+
+func (patterns interfacePatterns) match(iface string) bool {
+	for _, pattern := range patterns {
+		if iface == pattern || strings.HasPrefix(iface, pattern+".") {
+			return true
+		}
+		if ok, _ := path.Match(pattern, iface); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// interfaceAccess restricts the interfaces which are proxied. It is set from
+// the ALLOW_INTERFACES and DENY_INTERFACES environment variables.
+var interfaceAccess struct {
+	allow interfacePatterns
+	deny  interfacePatterns
+}
+
+// interfaceAllowed returns true if iface may be proxied: it must not be
+// denied and, if there is an allow list, it must be on it.
+func interfaceAllowed(iface string) bool {
+	if interfaceAccess.deny.match(iface) {
+		return false
+	}
+
+	return len(interfaceAccess.allow) == 0 || interfaceAccess.allow.match(iface)
+}
+
+// allowedInterfaces returns the interfaces in ifaces which may be proxied.
+func allowedInterfaces(ifaces []string) []string {
+	allowed := make([]string, 0, len(ifaces))
+	for _, iface := range ifaces {
+		if interfaceAllowed(iface) {
+			allowed = append(allowed, iface)
+		}
+	}
+
+	return allowed
+}
+
+// interfaceParameterMethods are the methods whose "interface" parameter
+// names an interface, which is subject to ALLOW_INTERFACES and
+// DENY_INTERFACES like the interface of the method itself.
+var interfaceParameterMethods = map[string]bool{
+	"org.varlink.resolver.Resolve":                true,
+	"org.varlink.service.GetInterfaceDescription": true,
+}
+
+// namedInterface returns the interface named by the "interface" parameter of
+// a call of method, if it is one of interfaceParameterMethods.
+func namedInterface(method string, parameters interface{}) string {
+	if !interfaceParameterMethods[method] {
+		return ""
+	}
+
+	b, err := json.Marshal(parameters)
+	if err != nil {
+		return ""
+	}
+
+	var in struct {
+		Interface string `json:"interface"`
+	}
+	if json.Unmarshal(b, &in) != nil {
+		return ""
+	}
+
+	return in.Interface
+}
+
+func interfaceNotAllowed(iface string) *varlink.Error {
+	return &varlink.Error{
+		Name:       "org.varlink.http.InterfaceNotAllowed",
+		Parameters: map[string]string{"interface": iface},
+	}
+}
+
+// addressPatterns is a list of service address patterns, which may contain
+// '*' wildcards, like "unix:/run/org.example.worker-*".
+type addressPatterns []string
+
+func parseAddressPatterns(s string) addressPatterns {
+	var patterns addressPatterns
+	for _, pattern := range strings.Split(s, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+
+	return patterns
+}
+
+func (patterns addressPatterns) match(address string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, address); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// followAddresses are the addresses calls with ?follow= may be sent to. It
+// is set from the FOLLOW_ADDRESSES environment variable, following is
+// disabled without it.
+var followAddresses addressPatterns
+
+// callAddresses are the addresses clients may call services at with an
+// "address" field or ?address= parameter, instead of resolving the
+// interface. It is set from the CALL_ADDRESSES environment variable,
+// explicit addresses are rejected without it.
+var callAddresses addressPatterns
+
+func addressNotAllowed(address string) *varlink.Error {
+	return &varlink.Error{
+		Name:       "org.varlink.http.AddressNotAllowed",
+		Parameters: map[string]string{"address": address},
+	}
+}
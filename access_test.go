@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCallAddressDisabled(t *testing.T) {
+	address := startTestService(t)
+	server := startProxy(t)
+
+	response, body := post(t, server.URL+"/", `{"method": "org.example.test.Echo", "parameters": {"text": "a", "number": 1}, "address": "`+address+`"}`)
+	checkStatus(t, response, body, http.StatusForbidden)
+	if !strings.Contains(body, "org.varlink.http.AddressNotAllowed") {
+		t.Errorf("got %s, expected org.varlink.http.AddressNotAllowed", body)
+	}
+
+	response, body = get(t, server.URL+"/interface/org.example.test?address="+address)
+	checkStatus(t, response, body, http.StatusForbidden)
+}
+
+func TestCallAddressNotAllowed(t *testing.T) {
+	address := startTestService(t)
+	t.Setenv("CALL_ADDRESSES", "unix:/run/org.example.test-*")
+	server := startProxy(t)
+
+	response, body := post(t, server.URL+"/", `{"method": "org.example.test.Echo", "parameters": {"text": "a", "number": 1}, "address": "`+address+`"}`)
+	checkStatus(t, response, body, http.StatusForbidden)
+	if !strings.Contains(body, "org.varlink.http.AddressNotAllowed") {
+		t.Errorf("got %s, expected org.varlink.http.AddressNotAllowed", body)
+	}
+}
+
+func TestCallAddressAllowed(t *testing.T) {
+	address := startTestService(t)
+	t.Setenv("CALL_ADDRESSES", address)
+	server := startProxy(t)
+
+	response, body := post(t, server.URL+"/", `{"method": "org.example.test.Echo", "parameters": {"text": "a", "number": 1}, "address": "`+address+`"}`)
+	checkStatus(t, response, body, http.StatusOK)
+	if expected := `{"parameters":{"number":1,"text":"a"}}` + "\n"; body != expected {
+		t.Errorf("got %q, expected %q", body, expected)
+	}
+
+	response, body = get(t, server.URL+"/interface/org.example.test?address="+address)
+	checkStatus(t, response, body, http.StatusOK)
+}
+
+func TestCallAddressDeniedInterface(t *testing.T) {
+	address := startTestService(t)
+	t.Setenv("CALL_ADDRESSES", address)
+	t.Setenv("DENY_INTERFACES", "org.example.test")
+	server := startProxy(t)
+
+	response, body := post(t, server.URL+"/", `{"method": "org.example.test.Echo", "parameters": {"text": "a", "number": 1}, "address": "`+address+`"}`)
+	checkStatus(t, response, body, http.StatusForbidden)
+
+	// the service at an allowed address still does not describe a denied
+	// interface through org.varlink.service
+	response, body = post(t, server.URL+"/", `{"method": "org.varlink.service.GetInterfaceDescription", "parameters": {"interface": "org.example.test"}, "address": "`+address+`"}`)
+	checkStatus(t, response, body, http.StatusForbidden)
+	if !strings.Contains(body, "org.varlink.http.InterfaceNotAllowed") {
+		t.Errorf("got %s, expected org.varlink.http.InterfaceNotAllowed", body)
+	}
+}
+
+func TestResolveDeniedInterface(t *testing.T) {
+	startTestService(t)
+	t.Setenv("DENY_INTERFACES", "org.example.test")
+	server := startProxy(t)
+
+	response, body := post(t, server.URL+"/", `{"method": "org.varlink.resolver.Resolve", "parameters": {"interface": "org.example.test"}}`)
+	checkStatus(t, response, body, http.StatusForbidden)
+	if !strings.Contains(body, "org.varlink.http.InterfaceNotAllowed") {
+		t.Errorf("got %s, expected org.varlink.http.InterfaceNotAllowed", body)
+	}
+}
+
+func TestIndexAllowedInterfaces(t *testing.T) {
+	t.Setenv("ALLOW_INTERFACES", " org.example.test,,org.example.a , org.example.test")
+	t.Setenv("DENY_INTERFACES", "org.example.a.*,")
+	startResolver(t, nil, []string{"org.example.c", "org.example.test", "org.example.a.x", "org.example.a", "org.example.test"})
+	server := startProxy(t)
+
+	response, body := get(t, server.URL+"/")
+	checkStatus(t, response, body, http.StatusOK)
+
+	var info resolverInfo
+	if err := json.Unmarshal([]byte(body), &info); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"org.example.a", "org.example.test"}; !reflect.DeepEqual(info.Interfaces, expected) {
+		t.Errorf("got %q, expected %q", info.Interfaces, expected)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFdsStart is the first file descriptor passed by socket activation.
+const listenFdsStart = 3
+
+var listenFdName = flag.String("listen-fd-name", "", "only serve on activated sockets with this `name` (from LISTEN_FDNAMES)")
+
+// activationListeners returns listeners for the sockets passed by systemd
+// socket activation. If name is not empty, only the sockets with that name
+// are used.
+func activationListeners(name string) ([]net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid LISTEN_PID: %q", os.Getenv("LISTEN_PID"))
+	}
+	if pid != os.Getpid() {
+		return nil, fmt.Errorf("LISTEN_PID %d does not match our pid %d", pid, os.Getpid())
+	}
+
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS: %q", os.Getenv("LISTEN_FDS"))
+	}
+
+	var names []string
+	if fdnames, ok := os.LookupEnv("LISTEN_FDNAMES"); ok {
+		names = strings.Split(fdnames, ":")
+		if len(names) != n {
+			return nil, fmt.Errorf("LISTEN_FDNAMES has %d names for %d sockets", len(names), n)
+		}
+	}
+
+	if name != "" && names == nil {
+		return nil, fmt.Errorf("socket name %q requested, but LISTEN_FDNAMES is not set", name)
+	}
+
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make([]net.Listener, 0, n)
+	for i := 0; i < n; i++ {
+		fdname := "listen-fd"
+		if names != nil {
+			fdname = names[i]
+		}
+		if name != "" && fdname != name {
+			continue
+		}
+
+		f := os.NewFile(uintptr(listenFdsStart+i), fdname)
+		listener, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid listen fd %d (%s): %s", listenFdsStart+i, fdname, err)
+		}
+
+		listeners = append(listeners, listener)
+	}
+
+	if len(listeners) == 0 {
+		return nil, fmt.Errorf("no socket named %q", name)
+	}
+
+	return listeners, nil
+}
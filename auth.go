@@ -0,0 +1,40 @@
+package main
+
+import (
+	"crypto/subtle"
+	"flag"
+	"net/http"
+	"strings"
+)
+
+var publicIntrospection = flag.Bool("public-introspection", false, "do not require AUTH_TOKEN for GET requests")
+var debugVars = flag.Bool("debug-vars", false, "serve internal counters at /debug/vars, requires AUTH_TOKEN")
+
+// privatePath returns true for the paths which always require the token,
+// even with -public-introspection.
+func privatePath(path string) bool {
+	return path == *basePath+"/config" || path == *basePath+"/debug/vars"
+}
+
+// requireToken wraps handler to require "Authorization: Bearer <token>" on
+// all requests. With publicGET, GET and HEAD requests, which cannot call
+// methods, are let through unauthenticated, except for private paths.
+func requireToken(token string, publicGET bool, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if publicGET && (request.Method == http.MethodGet || request.Method == http.MethodHead) &&
+			!privatePath(request.URL.Path) {
+			handler.ServeHTTP(writer, request)
+			return
+		}
+
+		authorization := request.Header.Get("Authorization")
+		given := strings.TrimPrefix(authorization, "Bearer ")
+		if given == authorization || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			writer.Header().Set("WWW-Authenticate", `Bearer realm="org.varlink.http"`)
+			httpError(writer, request, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		handler.ServeHTTP(writer, request)
+	})
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDebugVars(t *testing.T) {
+	t.Setenv("AUTH_TOKEN", "secret")
+	setFlag(t, "public-introspection", "true")
+	setFlag(t, "debug-vars", "true")
+	server := startProxy(t)
+
+	response, body := get(t, server.URL+"/debug/vars")
+	checkStatus(t, response, body, http.StatusUnauthorized)
+
+	request := newRequest(t, http.MethodGet, server.URL+"/debug/vars", "")
+	request.Header.Set("Authorization", "Bearer secret")
+	response, body = do(t, request)
+	checkStatus(t, response, body, http.StatusOK)
+	if !strings.Contains(body, `"connections"`) {
+		t.Errorf("got %s, expected the connections counter", body)
+	}
+}
+
+func TestDebugVarsDisabled(t *testing.T) {
+	t.Setenv("AUTH_TOKEN", "secret")
+	server := startProxy(t)
+
+	request := newRequest(t, http.MethodGet, server.URL+"/debug/vars", "")
+	request.Header.Set("Authorization", "Bearer secret")
+	response, body := do(t, request)
+	if response.StatusCode == http.StatusOK || strings.Contains(body, `"connections"`) {
+		t.Errorf("got %d %s, expected /debug/vars not to be served", response.StatusCode, body)
+	}
+}
+
+func TestDebugVarsRequiresToken(t *testing.T) {
+	setFlag(t, "debug-vars", "true")
+
+	if _, err := newHandler(); err == nil {
+		t.Error("expected an error without AUTH_TOKEN")
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var basePath = flag.String("base-path", "", "serve all pages below URL `path`, when running behind a reverse proxy")
+
+// checkBasePath normalizes -base-path to either the empty string or a path
+// starting, but not ending, with a slash.
+func checkBasePath() error {
+	p := strings.TrimSuffix(*basePath, "/")
+	if p != "" && !strings.HasPrefix(p, "/") {
+		return fmt.Errorf("invalid base path %q: must start with /", *basePath)
+	}
+
+	*basePath = p
+	return nil
+}
+
+// withBasePath serves handler below -base-path. The prefix is removed from
+// request paths, handlers must add it back to URLs they return to clients.
+func withBasePath(handler http.Handler) http.Handler {
+	stripped := http.StripPrefix(*basePath, handler)
+
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == *basePath {
+			http.Redirect(writer, request, *basePath+"/", http.StatusMovedPermanently)
+			return
+		}
+
+		if !strings.HasPrefix(request.URL.Path, *basePath+"/") {
+			httpError(writer, request, "Not found", http.StatusNotFound)
+			return
+		}
+
+		stripped.ServeHTTP(writer, request)
+	})
+}
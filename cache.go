@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/varlink/go/varlink"
+	"github.com/varlink/go/varlink/idl"
+)
+
+var leadingComments = flag.Bool("leading-comments", false, "show all comment blocks before the interface keyword as interface documentation, not only the last one")
+var interfaceCacheTTL = flag.Duration("interface-cache-ttl", 5*time.Minute, "refetch interface descriptions after `duration` (0 caches them until invalidated)")
+
+type idlCacheEntry struct {
+	idl     *idl.IDL
+	fetched time.Time
+}
+
+// idlCache holds parsed interface descriptions, keyed by interface name.
+type idlCache struct {
+	mutex   sync.Mutex
+	entries map[string]idlCacheEntry
+}
+
+var interfaces = idlCache{entries: make(map[string]idlCacheEntry)}
+
+func (entry idlCacheEntry) expired(now time.Time) bool {
+	return *interfaceCacheTTL > 0 && now.Sub(entry.fetched) >= *interfaceCacheTTL
+}
+
+// describe returns the parsed description of iface, fetching it from the
+// service implementing it if it is not cached or the cached one expired.
+func (cache *idlCache) describe(iface string) (*idl.IDL, error) {
+	cache.mutex.Lock()
+	entry, ok := cache.entries[iface]
+	cache.mutex.Unlock()
+	if ok && !entry.expired(time.Now()) {
+		return entry.idl, nil
+	}
+
+	i, err := fetchDescription(iface, "")
+	if err != nil {
+		return nil, err
+	}
+
+	cache.mutex.Lock()
+	cache.entries[iface] = idlCacheEntry{idl: i, fetched: time.Now()}
+	cache.mutex.Unlock()
+
+	return i, nil
+}
+
+// fetchDescription fetches and parses the description of iface from the
+// service at address, or from the service implementing it if address is
+// empty.
+func fetchDescription(iface string, address string) (*idl.IDL, error) {
+	c, address, err := connect(iface, address)
+	if err != nil {
+		return nil, err
+	}
+	defer closeConnection(c)
+
+	i, err := describeService(c, iface, address)
+	if err != nil {
+		return nil, err
+	}
+
+	// never serve a description under the name of another interface
+	if i.Name != iface {
+		return nil, &varlink.Error{
+			Name: "org.varlink.http.InterfaceMismatch",
+			Parameters: map[string]string{
+				"interface": iface,
+				"address":   address,
+				"received":  i.Name,
+			},
+		}
+	}
+
+	return i, nil
+}
+
+// describeService requests the description of iface from the service
+// connected with c and parses it. Failures are classified, so clients can
+// tell services not knowing the interface (404) or not supporting
+// introspection (501) from services sending invalid replies (502).
+func describeService(c *varlink.Connection, iface string, address string) (*idl.IDL, error) {
+	desc, err := c.GetInterfaceDescription(iface)
+	if err != nil {
+		var verr *varlink.Error
+		var netErr net.Error
+		switch {
+		case errors.As(err, &verr):
+			if verr.Name == "org.varlink.service.MethodNotFound" || verr.Name == "org.varlink.service.MethodNotImplemented" {
+				return nil, &varlink.Error{
+					Name:       "org.varlink.http.IntrospectionNotSupported",
+					Parameters: map[string]string{"interface": iface, "address": address},
+				}
+			}
+			return nil, err
+
+		case errors.As(err, &netErr), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF),
+			errors.Is(err, varlink.ErrMessageTooLarge):
+			// connection errors are classified by errorStatus
+			return nil, err
+		}
+
+		return nil, invalidDescription(iface, address, "invalid reply: "+err.Error())
+	}
+	if strings.TrimSpace(desc) == "" {
+		return nil, emptyDescription(iface, address)
+	}
+
+	i, err := idl.NewWithOptions(desc, idl.Options{LeadingComments: *leadingComments})
+	if err != nil {
+		return nil, invalidDescription(iface, address, err.Error())
+	}
+
+	return i, nil
+}
+
+// invalidDescription returns the error for a service at address sending an
+// invalid reply to a request for the description of iface.
+func invalidDescription(iface string, address string, message string) *varlink.Error {
+	return &varlink.Error{
+		Name: "org.varlink.http.InvalidServiceDescription",
+		Parameters: map[string]string{
+			"interface": iface,
+			"address":   address,
+			"message":   message,
+		},
+	}
+}
+
+// emptyDescription returns the error for a service at address sending an
+// empty description of iface, which would otherwise fail to parse.
+func emptyDescription(iface string, address string) *varlink.Error {
+	return &varlink.Error{
+		Name: "org.varlink.http.EmptyDescription",
+		Parameters: map[string]string{
+			"interface": iface,
+			"address":   address,
+			"message":   "backend returned an empty interface description for " + iface,
+		},
+	}
+}
+
+// invalidate removes the cached description of iface.
+func (cache *idlCache) invalidate(iface string) {
+	cache.mutex.Lock()
+	delete(cache.entries, iface)
+	cache.mutex.Unlock()
+}
+
+// sweep removes all expired descriptions.
+func (cache *idlCache) sweep() {
+	now := time.Now()
+
+	cache.mutex.Lock()
+	for iface, entry := range cache.entries {
+		if entry.expired(now) {
+			delete(cache.entries, iface)
+		}
+	}
+	cache.mutex.Unlock()
+}
+
+// sweepPeriodically sweeps the cache once per TTL, if there is one.
+func (cache *idlCache) sweepPeriodically() {
+	if *interfaceCacheTTL <= 0 {
+		return
+	}
+
+	go func() {
+		for range time.Tick(*interfaceCacheTTL) {
+			cache.sweep()
+		}
+	}()
+}
@@ -0,0 +1,97 @@
+// Package client calls varlink methods through an org.varlink.http proxy.
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/varlink/go/varlink"
+)
+
+// DefaultClient is the HTTP client used by Call, and by clients without
+// their own HTTPClient.
+var DefaultClient = http.DefaultClient
+
+// Client calls methods through the proxy at BaseURL.
+type Client struct {
+	// BaseURL is the URL of the proxy, including its base path.
+	BaseURL string
+
+	// Token is sent as "Authorization: Bearer <token>" if set, for
+	// proxies requiring AUTH_TOKEN.
+	Token string
+
+	// HTTPClient sends the requests, DefaultClient if nil.
+	HTTPClient *http.Client
+}
+
+// Call calls method with params on the proxy at baseURL, see Client.Call.
+func Call(baseURL string, method string, params interface{}, reply interface{}) error {
+	c := Client{BaseURL: baseURL}
+	return c.Call(method, params, reply)
+}
+
+// Call calls method with params and decodes the parameters of the reply
+// into reply, which may be nil. Errors returned by the method or the proxy
+// are returned as *varlink.Error, with their parameters as
+// json.RawMessage.
+func (c *Client) Call(method string, params interface{}, reply interface{}) error {
+	type call struct {
+		Method     string      `json:"method"`
+		Parameters interface{} `json:"parameters,omitempty"`
+	}
+
+	body, err := json.Marshal(call{method, params})
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(c.BaseURL, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Accept", "application/json")
+	if c.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = DefaultClient
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	var out struct {
+		Parameters json.RawMessage `json:"parameters"`
+		Error      string          `json:"error"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&out)
+	if err != nil {
+		return fmt.Errorf("invalid reply from %s (%s): %s", c.BaseURL, response.Status, err)
+	}
+
+	if out.Error != "" {
+		return &varlink.Error{
+			Name:       out.Error,
+			Parameters: out.Parameters,
+		}
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected reply from %s: %s", c.BaseURL, response.Status)
+	}
+
+	if reply != nil && out.Parameters != nil {
+		return json.Unmarshal(out.Parameters, reply)
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/varlink/go/varlink"
+)
+
+// newProxy returns a server answering calls like the proxy, with the
+// reply returned by handle for the decoded call.
+func newProxy(t *testing.T, token string, handle func(method string, parameters json.RawMessage) (int, string)) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if token != "" && request.Header.Get("Authorization") != "Bearer "+token {
+			writer.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(writer, `{"error": "org.varlink.http.Unauthorized", "parameters": {"message": "Unauthorized"}}`)
+			return
+		}
+
+		var call struct {
+			Method     string
+			Parameters json.RawMessage
+		}
+		if request.Method != http.MethodPost || request.URL.Path != "/" || json.NewDecoder(request.Body).Decode(&call) != nil {
+			t.Errorf("unexpected request %s %s", request.Method, request.URL)
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		status, body := handle(call.Method, call.Parameters)
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(status)
+		io.WriteString(writer, body)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestCall(t *testing.T) {
+	server := newProxy(t, "", func(method string, parameters json.RawMessage) (int, string) {
+		if method != "org.example.test.Echo" || string(parameters) != `{"text":"hello"}` {
+			t.Errorf("got call of %s with %s", method, parameters)
+		}
+		return http.StatusOK, `{"parameters": {"text": "hello"}}`
+	})
+
+	var reply struct {
+		Text string `json:"text"`
+	}
+	if err := Call(server.URL, "org.example.test.Echo", map[string]string{"text": "hello"}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Text != "hello" {
+		t.Errorf("got %q, expected hello", reply.Text)
+	}
+}
+
+func TestCallError(t *testing.T) {
+	server := newProxy(t, "", func(method string, parameters json.RawMessage) (int, string) {
+		return http.StatusBadRequest, `{"error": "org.example.test.Failed", "parameters": {"reason": "test"}}`
+	})
+
+	err := Call(server.URL+"/", "org.example.test.Fail", nil, nil)
+
+	var verr *varlink.Error
+	if !errors.As(err, &verr) {
+		t.Fatalf("got %v, expected a *varlink.Error", err)
+	}
+	if verr.Name != "org.example.test.Failed" {
+		t.Errorf("got error %q, expected org.example.test.Failed", verr.Name)
+	}
+
+	var parameters struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal(verr.Parameters.(json.RawMessage), &parameters); err != nil {
+		t.Fatal(err)
+	}
+	if parameters.Reason != "test" {
+		t.Errorf("got reason %q, expected test", parameters.Reason)
+	}
+}
+
+func TestCallInvalidReply(t *testing.T) {
+	server := newProxy(t, "", func(method string, parameters json.RawMessage) (int, string) {
+		return http.StatusBadGateway, `<html>Bad Gateway</html>`
+	})
+
+	err := Call(server.URL, "org.example.test.Echo", nil, nil)
+	var verr *varlink.Error
+	if err == nil || errors.As(err, &verr) {
+		t.Errorf("got %v, expected an error which is not a *varlink.Error", err)
+	}
+}
+
+func TestClientToken(t *testing.T) {
+	server := newProxy(t, "secret", func(method string, parameters json.RawMessage) (int, string) {
+		return http.StatusOK, `{}`
+	})
+
+	c := Client{BaseURL: server.URL, Token: "secret", HTTPClient: server.Client()}
+	if err := c.Call("org.example.test.Nothing", nil, nil); err != nil {
+		t.Errorf("got %v with the token", err)
+	}
+
+	c.Token = "wrong"
+	err := c.Call("org.example.test.Nothing", nil, nil)
+	var verr *varlink.Error
+	if !errors.As(err, &verr) || verr.Name != "org.varlink.http.Unauthorized" {
+		t.Errorf("got %v, expected org.varlink.http.Unauthorized", err)
+	}
+}
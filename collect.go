@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"time"
+
+	"github.com/varlink/go/varlink"
+)
+
+var collectMaxReplies = flag.Int("collect-max-replies", 1000, "return up to `number` replies to calls with ?collect=true")
+var collectTimeout = flag.Duration("collect-timeout", time.Minute, "maximum `duration` of calls with ?collect=true (0 is unlimited)")
+
+// wantsCollect returns true if the client asked for all replies of a call
+// in a single JSON array.
+func wantsCollect(request *http.Request) bool {
+	return request.URL.Query().Get("collect") == "true"
+}
+
+// collectReplies receives all replies to a method call on c. If the
+// service sends more than -collect-max-replies, the call is aborted with an
+// org.varlink.http.TooManyReplies error and c must not be reused.
+func collectReplies(c *varlink.Connection, receive func(interface{}) (uint64, error)) ([]json.RawMessage, error) {
+	if *collectTimeout > 0 {
+		c.SetDeadline(time.Now().Add(*collectTimeout))
+		defer c.SetDeadline(time.Time{})
+	}
+
+	replies := []json.RawMessage{}
+	for {
+		var parameters json.RawMessage
+		flags, err := receive(&parameters)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(replies) == *collectMaxReplies {
+			return nil, &varlink.Error{
+				Name:       "org.varlink.http.TooManyReplies",
+				Parameters: map[string]int{"limit": *collectMaxReplies},
+			}
+		}
+		replies = append(replies, parameters)
+
+		if flags&varlink.Continues == 0 {
+			return replies, nil
+		}
+	}
+}
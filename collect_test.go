@@ -0,0 +1,28 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCallCollect(t *testing.T) {
+	startTestService(t)
+	server := startProxy(t)
+
+	response, body := post(t, server.URL+"/?collect=true", `{"method": "org.example.test.Count", "parameters": {"count": 3}}`)
+	checkStatus(t, response, body, http.StatusOK)
+
+	expected := `[{"i":0},{"i":1},{"i":2}]` + "\n"
+	if body != expected {
+		t.Errorf("got %q, expected %q", body, expected)
+	}
+}
+
+func TestCallCollectTooManyReplies(t *testing.T) {
+	startTestService(t)
+	setFlag(t, "collect-max-replies", "2")
+	server := startProxy(t)
+
+	response, body := post(t, server.URL+"/?collect=true", `{"method": "org.example.test.Count", "parameters": {"count": 3}}`)
+	checkStatus(t, response, body, http.StatusRequestEntityTooLarge)
+}
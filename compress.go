@@ -0,0 +1,75 @@
+package main
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"flag"
+	"io"
+	"net/http"
+	"strings"
+)
+
+var maxRequestSize = flag.Int64("max-request-size", 16<<20, "reject request bodies larger than `bytes`, after decompression")
+
+// decompressedBody reads the body of a request sent with a Content-Encoding
+// and closes the original body with it.
+type decompressedBody struct {
+	io.ReadCloser
+	body io.Closer
+}
+
+func (b decompressedBody) Close() error {
+	b.ReadCloser.Close()
+	return b.body.Close()
+}
+
+// withRequestBody decompresses gzip and deflate encoded request bodies and
+// limits their size. The limit applies to the decompressed body, to keep
+// small compressed bodies from expanding without bound.
+func withRequestBody(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		var err error
+		var body io.ReadCloser
+
+		switch encoding := strings.ToLower(strings.TrimSpace(request.Header.Get("Content-Encoding"))); encoding {
+		case "", "identity":
+			request.Body = http.MaxBytesReader(writer, request.Body, *maxRequestSize)
+			handler.ServeHTTP(writer, request)
+			return
+
+		case "gzip", "x-gzip":
+			body, err = gzip.NewReader(request.Body)
+
+		case "deflate":
+			body, err = zlib.NewReader(request.Body)
+
+		default:
+			httpError(writer, request, "Unsupported Content-Encoding: "+encoding, http.StatusUnsupportedMediaType)
+			return
+		}
+		if err != nil {
+			httpError(writer, request, "Invalid "+request.Header.Get("Content-Encoding")+" body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		request = request.Clone(request.Context())
+		request.Header.Del("Content-Encoding")
+		request.Header.Del("Content-Length")
+		request.ContentLength = -1
+		request.Body = http.MaxBytesReader(writer, decompressedBody{body, request.Body}, *maxRequestSize)
+
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+// bodyError writes the error reply for an invalid request body. Bodies
+// exceeding -max-request-size are rejected with 413.
+func bodyError(writer http.ResponseWriter, request *http.Request, err error) {
+	if errors.As(err, new(*http.MaxBytesError)) {
+		httpError(writer, request, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	httpError(writer, request, err.Error(), http.StatusBadRequest)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func gzipped(t *testing.T, s string) string {
+	t.Helper()
+
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	if _, err := w.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return b.String()
+}
+
+// largeCall returns a call whose body is larger than size.
+func largeCall(size int) string {
+	return `{"method": "org.example.test.Echo", "parameters": {"text": "` + strings.Repeat("a", size) + `", "number": 1}}`
+}
+
+func TestCompressedRequestBody(t *testing.T) {
+	startTestService(t)
+	server := startProxy(t)
+
+	request := newRequest(t, http.MethodPost, server.URL+"/", gzipped(t, `{"method": "org.example.test.Echo", "parameters": {"text": "hello", "number": 1}}`))
+	request.Header.Set("Content-Encoding", "gzip")
+	response, body := do(t, request)
+	checkStatus(t, response, body, http.StatusOK)
+
+	if expected := `{"parameters":{"number":1,"text":"hello"}}` + "\n"; body != expected {
+		t.Errorf("got %q, expected %q", body, expected)
+	}
+}
+
+func TestRequestBodyTooLarge(t *testing.T) {
+	setFlag(t, "max-request-size", "1024")
+	server := startProxy(t)
+
+	for _, path := range []string{"/", "/call/org.example.test.Echo", "/diff", "/parse", "/session"} {
+		response, body := post(t, server.URL+path, largeCall(2048))
+		checkStatus(t, response, body, http.StatusRequestEntityTooLarge)
+	}
+
+	request := newRequest(t, http.MethodPost, server.URL+"/", "method=org.example.test.Echo&text="+strings.Repeat("a", 2048))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response, body := do(t, request)
+	checkStatus(t, response, body, http.StatusRequestEntityTooLarge)
+}
+
+func TestCompressedRequestBodyTooLarge(t *testing.T) {
+	setFlag(t, "max-request-size", "1024")
+	server := startProxy(t)
+
+	// the compressed body is below the limit, the decompressed one not
+	compressed := gzipped(t, largeCall(64<<10))
+	if len(compressed) >= 1024 {
+		t.Fatalf("compressed body has %d bytes, expected less than the limit", len(compressed))
+	}
+
+	request := newRequest(t, http.MethodPost, server.URL+"/", compressed)
+	request.Header.Set("Content-Encoding", "gzip")
+	response, body := do(t, request)
+	checkStatus(t, response, body, http.StatusRequestEntityTooLarge)
+}
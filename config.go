@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+)
+
+var serveConfig = flag.Bool("serve-config", false, "serve the effective configuration at /config, requires AUTH_TOKEN")
+
+// flagEnvironment maps environment variables to the flags they set, if the
+// flag is not given on the command line.
+var flagEnvironment = map[string]string{
+	"BASE_PATH":                "base-path",
+	"CONNECTION_QUEUE_TIMEOUT": "connection-queue-timeout",
+	"DEFAULT_ACCEPT":           "default-accept",
+	"H2C":                      "h2c",
+	"MAX_CONNECTIONS":          "max-connections",
+	"MAX_SESSIONS":             "max-sessions",
+	"REQUEST_TIMEOUT":          "request-timeout",
+	"RESOLVER_ADDRESS":         "resolver-address",
+	"SERVICE_NAME":             "service-name",
+	"SLOW_CALL_THRESHOLD":      "slow-call-threshold",
+	"SMOKE_TESTS":              "smoke-tests",
+	"VERBOSE_ERRORS":           "verbose-errors",
+}
+
+func setFlagsFromEnvironment() error {
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	for env, name := range flagEnvironment {
+		value, ok := os.LookupEnv(env)
+		if !ok || given[name] {
+			continue
+		}
+
+		if err := flag.Set(name, value); err != nil {
+			return fmt.Errorf("invalid %s: %s", env, err)
+		}
+	}
+
+	return nil
+}
+
+// environmentSettings are the settings only read from the environment.
+// The values of secret ones are not revealed.
+var environmentSettings = map[string]bool{
+	"ALLOW_INTERFACES": false,
+	"AUTH_TOKEN":       true,
+	"CALL_ADDRESSES":   false,
+	"DENY_INTERFACES":  false,
+	"FOLLOW_ADDRESSES": false,
+	"LISTEN_ADDRESS":   false,
+	"RATE_LIMITS":      false,
+	"TRUSTED_PROXIES":  false,
+
+	"OTEL_EXPORTER_OTLP_ENDPOINT":        false,
+	"OTEL_EXPORTER_OTLP_HEADERS":         true,
+	"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": false,
+	"OTEL_EXPORTER_OTLP_TRACES_HEADERS":  true,
+	"OTEL_SERVICE_NAME":                  false,
+	"OTEL_TRACES_EXPORTER":               false,
+}
+
+// effectiveConfiguration returns the values of all flags and environment
+// settings, and the resolver address.
+func effectiveConfiguration() map[string]string {
+	config := map[string]string{
+		"resolver": *resolverAddress,
+	}
+
+	flag.VisitAll(func(f *flag.Flag) {
+		config[f.Name] = f.Value.String()
+	})
+
+	for env, secret := range environmentSettings {
+		value, ok := os.LookupEnv(env)
+		if !ok {
+			continue
+		}
+		if secret {
+			value = "redacted"
+		}
+		config[env] = value
+	}
+
+	return config
+}
+
+// logConfiguration logs the effective configuration in a single line.
+func logConfiguration() {
+	b, err := json.Marshal(effectiveConfiguration())
+	if err != nil {
+		log.Print(err.Error())
+		return
+	}
+
+	log.Printf("configuration: %s", b)
+}
+
+func serveConfiguration(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		httpError(writer, request, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	newEncoder(writer, request).Encode(effectiveConfiguration())
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/varlink/go/varlink/idl"
+)
+
+var arrayExamples = flag.Bool("array-examples", true, "show an example element in default array values of method forms")
+
+// defaultValue returns an example value of type t, resolving type aliases
+// to their underlying types.
+func defaultValue(i *idl.IDL, t *idl.Type) interface{} {
+	return defaultValueOf(i, t, make(map[string]bool))
+}
+
+// defaultValueOf returns an example value of type t. Aliases currently being
+// expanded are kept in expanding, to stop at recursive types.
+func defaultValueOf(i *idl.IDL, t *idl.Type, expanding map[string]bool) interface{} {
+	switch t.Kind {
+	case idl.TypeBool:
+		return false
+
+	case idl.TypeInt:
+		return 0
+
+	case idl.TypeFloat:
+		return 0.0
+
+	case idl.TypeString:
+		return ""
+
+	case idl.TypeArray:
+		if !*arrayExamples {
+			return make([]interface{}, 0)
+		}
+		element := defaultValueOf(i, t.ElementType, expanding)
+		if element == nil {
+			return make([]interface{}, 0)
+		}
+		return []interface{}{element}
+
+	case idl.TypeEnum:
+		if len(t.Fields) == 0 {
+			return ""
+		}
+		return t.Fields[0].Name
+
+	case idl.TypeMap, idl.TypeObject:
+		return newOrderedObject()
+
+	case idl.TypeStruct:
+		v := newOrderedObject()
+		for _, field := range t.Fields {
+			v.set(field.Name, defaultValueOf(i, field.Type, expanding))
+		}
+		return v
+
+	case idl.TypeAlias:
+		if expanding[t.Alias] {
+			return nil
+		}
+		for _, alias := range i.Aliases {
+			if alias.Name == t.Alias {
+				expanding[t.Alias] = true
+				v := defaultValueOf(i, alias.Type, expanding)
+				delete(expanding, t.Alias)
+				return v
+			}
+		}
+		return nil
+	}
+
+	return nil
+}
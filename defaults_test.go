@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"html"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/varlink/go/varlink/idl"
+)
+
+// defaultJSON returns the default value of the parameters of the first
+// method of description as JSON.
+func defaultJSON(t *testing.T, description string) string {
+	t.Helper()
+
+	i, err := idl.New(description)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(defaultValue(i, i.Methods[0].In))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(b)
+}
+
+func TestDefaultValueAliases(t *testing.T) {
+	for _, test := range []struct {
+		description string
+		expected    string
+	}{
+		{"type A B\ntype B C\ntype C (x: int)\nmethod M(a: A) -> ()\n", `{"a":{"x":0}}`},
+		{"type A (b: B)\ntype B (c: []C)\ntype C (x: string)\nmethod M(a: A) -> ()\n", `{"a":{"b":{"c":[{"x":""}]}}}`},
+		{"type A B\ntype B A\nmethod M(a: A, n: int) -> ()\n", `{"a":null,"n":0}`},
+		{"type A (b: B)\ntype B (a: A)\nmethod M(a: A) -> ()\n", `{"a":{"b":{"a":null}}}`},
+		{"type Node (value: int, next: ?Node)\nmethod M(node: Node) -> ()\n", `{"node":{"value":0,"next":null}}`},
+		{"type Node (children: []Node)\nmethod M(node: Node) -> ()\n", `{"node":{"children":[]}}`},
+		{"method M(a: Missing) -> ()\n", `{"a":null}`},
+		// an alias used twice side by side is expanded both times
+		{"type A (x: int)\nmethod M(a: A, b: A) -> ()\n", `{"a":{"x":0},"b":{"x":0}}`},
+	} {
+		if got := defaultJSON(t, "interface org.example.test\n"+test.description); got != test.expected {
+			t.Errorf("%q: got %s, expected %s", test.description, got, test.expected)
+		}
+	}
+}
+
+func TestMethodPageRecursiveAliases(t *testing.T) {
+	iface := newTestInterface()
+	iface.description = "interface org.example.test\ntype A B\ntype B (a: ?A, list: []B)\nmethod Get(a: A) -> ()\nerror Failed (a: A)\n"
+	startTestService(t, iface)
+	server := startProxy(t)
+
+	request := newRequest(t, http.MethodGet, server.URL+"/interface/org.example.test/Get", "")
+	request.Header.Set("Accept", "text/html")
+	response, body := do(t, request)
+	checkStatus(t, response, body, http.StatusOK)
+	if !strings.Contains(body, "&#34;list&#34;: []") {
+		t.Errorf("default value missing:\n%s", body)
+	}
+}
+
+func TestDefaultValueNested(t *testing.T) {
+	for _, test := range []struct {
+		description string
+		expected    string
+	}{
+		{"method M(a: (b: (c: int))) -> ()\n", `{"a":{"b":{"c":0}}}`},
+		{"method M(a: (b: [](c: int))) -> ()\n", `{"a":{"b":[{"c":0}]}}`},
+		{"method M(a: [][](c: float, d: bool)) -> ()\n", `{"a":[[{"c":0,"d":false}]]}`},
+		{"method M(a: [string](b: int), c: [string][]int, o: object) -> ()\n", `{"a":{},"c":{},"o":{}}`},
+		{"method M(a: []?(b: int), e: [](x, y)) -> ()\n", `{"a":[],"e":["x"]}`},
+		{"type T (b: []U)\ntype U (c: [](d: string))\nmethod M(a: []T) -> ()\n", `{"a":[{"b":[{"c":[{"d":""}]}]}]}`},
+	} {
+		if got := defaultJSON(t, "interface org.example.test\n"+test.description); got != test.expected {
+			t.Errorf("%q: got %s, expected %s", test.description, got, test.expected)
+		}
+	}
+}
+
+func TestDefaultValueWithoutArrayExamples(t *testing.T) {
+	setFlag(t, "array-examples", "false")
+
+	description := "interface org.example.test\nmethod M(a: (b: [](c: int)), d: [][]int) -> ()\n"
+	if got, expected := defaultJSON(t, description), `{"a":{"b":[]},"d":[]}`; got != expected {
+		t.Errorf("got %s, expected %s", got, expected)
+	}
+}
+
+func TestMethodPageNestedDefaults(t *testing.T) {
+	iface := newTestInterface()
+	iface.description = "interface org.example.test\ntype Item (name: string, tags: [string]string)\nmethod Get(a: (b: [](c: int, items: []Item))) -> ()\n"
+	startTestService(t, iface)
+	server := startProxy(t)
+
+	request := newRequest(t, http.MethodGet, server.URL+"/interface/org.example.test/Get", "")
+	request.Header.Set("Accept", "text/html")
+	response, body := do(t, request)
+	checkStatus(t, response, body, http.StatusOK)
+
+	expected := `{
+  "a": {
+    "b": [
+      {
+        "c": 0,
+        "items": [
+          {
+            "name": "",
+            "tags": {}
+          }
+        ]
+      }
+    ]
+  }
+}`
+	if !strings.Contains(html.UnescapeString(body), expected) {
+		t.Errorf("default value %s missing:\n%s", expected, body)
+	}
+}
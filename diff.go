@@ -0,0 +1,203 @@
+package main
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/varlink/go/varlink"
+	"github.com/varlink/go/varlink/idl"
+)
+
+// diffSource is one side of a diff, either an interface description or the
+// name of an interface to fetch from its service, or from the service at
+// Address, which must match CALL_ADDRESSES like the address of a call.
+type diffSource struct {
+	Description string `json:"description"`
+	Interface   string `json:"interface"`
+	Address     string `json:"address"`
+}
+
+type signatureChange struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// memberChange describes a member whose signature changed. Types and errors
+// have a Type, methods have In and Out, each only set if it changed.
+type memberChange struct {
+	Name string           `json:"name"`
+	Type *signatureChange `json:"type,omitempty"`
+	In   *signatureChange `json:"in,omitempty"`
+	Out  *signatureChange `json:"out,omitempty"`
+}
+
+type memberDiff struct {
+	Added   []string       `json:"added"`
+	Removed []string       `json:"removed"`
+	Changed []memberChange `json:"changed"`
+}
+
+type interfaceDiff struct {
+	Types   memberDiff `json:"types"`
+	Methods memberDiff `json:"methods"`
+	Errors  memberDiff `json:"errors"`
+}
+
+// diffMember is the name and signature of an interface member, with a
+// signature of one type for types and errors, and two for methods.
+type diffMember struct {
+	name       string
+	signatures []string
+}
+
+// errorSignature returns the parameters of e, errors without parameters
+// have an empty struct.
+func errorSignature(e *idl.Error) string {
+	if e.Type == nil {
+		return "()"
+	}
+
+	return e.Type.String()
+}
+
+func diffMembers(i *idl.IDL, kind string) []diffMember {
+	var members []diffMember
+	for _, member := range i.Members {
+		switch m := member.(type) {
+		case *idl.Alias:
+			if kind == "type" {
+				members = append(members, diffMember{m.Name, []string{m.Type.String()}})
+			}
+
+		case *idl.Method:
+			if kind == "method" {
+				members = append(members, diffMember{m.Name, []string{m.In.String(), m.Out.String()}})
+			}
+
+		case *idl.Error:
+			if kind == "error" {
+				members = append(members, diffMember{m.Name, []string{errorSignature(m)}})
+			}
+		}
+	}
+
+	return members
+}
+
+func change(before string, after string) *signatureChange {
+	if before == after {
+		return nil
+	}
+
+	return &signatureChange{before, after}
+}
+
+// diffKind compares the members of one kind. Added and changed members are
+// listed in the order of the new interface, removed ones in the order of
+// the old one.
+func diffKind(before *idl.IDL, after *idl.IDL, kind string) memberDiff {
+	d := memberDiff{
+		Added:   make([]string, 0),
+		Removed: make([]string, 0),
+		Changed: make([]memberChange, 0),
+	}
+
+	oldMembers := make(map[string]diffMember)
+	for _, m := range diffMembers(before, kind) {
+		oldMembers[m.name] = m
+	}
+
+	newMembers := make(map[string]bool)
+	for _, m := range diffMembers(after, kind) {
+		newMembers[m.name] = true
+
+		o, ok := oldMembers[m.name]
+		if !ok {
+			d.Added = append(d.Added, m.name)
+			continue
+		}
+
+		c := memberChange{Name: m.name}
+		if kind == "method" {
+			c.In = change(o.signatures[0], m.signatures[0])
+			c.Out = change(o.signatures[1], m.signatures[1])
+		} else {
+			c.Type = change(o.signatures[0], m.signatures[0])
+		}
+		if c.Type != nil || c.In != nil || c.Out != nil {
+			d.Changed = append(d.Changed, c)
+		}
+	}
+
+	for _, m := range diffMembers(before, kind) {
+		if !newMembers[m.name] {
+			d.Removed = append(d.Removed, m.name)
+		}
+	}
+
+	return d
+}
+
+func diffInterfaces(before *idl.IDL, after *idl.IDL) interfaceDiff {
+	return interfaceDiff{
+		Types:   diffKind(before, after, "type"),
+		Methods: diffKind(before, after, "method"),
+		Errors:  diffKind(before, after, "error"),
+	}
+}
+
+// load parses or fetches the interface of the source. Named interfaces are
+// always fetched from the service, not taken from the cache.
+func (source diffSource) load() (*idl.IDL, error) {
+	if source.Description == "" {
+		if source.Interface == "" {
+			return nil, invalidParameter("interface")
+		}
+		return fetchDescription(source.Interface, source.Address)
+	}
+
+	i, err := idl.New(source.Description)
+	if err != nil {
+		return nil, &varlink.Error{
+			Name:       "org.varlink.http.InvalidInterfaceDescription",
+			Parameters: map[string]string{"message": err.Error()},
+		}
+	}
+
+	return i, nil
+}
+
+// serveDiff compares two interfaces and returns the types, methods and
+// errors which were added, removed or changed.
+func serveDiff(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		httpError(writer, request, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var in struct {
+		Old diffSource `json:"old"`
+		New diffSource `json:"new"`
+	}
+	request.Body = http.MaxBytesReader(writer, request.Body, 2*maxDescriptionSize)
+	err := decodeBody(request, &in)
+	if err != nil && err != io.EOF {
+		bodyError(writer, request, err)
+		return
+	}
+
+	before, err := in.Old.load()
+	if err != nil {
+		callError(writer, request, err)
+		return
+	}
+
+	after, err := in.New.load()
+	if err != nil {
+		callError(writer, request, err)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	newEncoder(writer, request).Encode(diffInterfaces(before, after))
+}
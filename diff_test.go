@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/varlink/go/varlink/idl"
+)
+
+// diff posts the descriptions before and after to /diff and returns the
+// decoded diff.
+func diff(t *testing.T, before string, after string) interfaceDiff {
+	t.Helper()
+
+	body, err := json.Marshal(map[string]diffSource{
+		"old": {Description: before},
+		"new": {Description: after},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := httptest.NewRequest(http.MethodPost, "/diff", strings.NewReader(string(body)))
+	recorder := httptest.NewRecorder()
+	serveDiff(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", recorder.Code, recorder.Body)
+	}
+
+	var d interfaceDiff
+	if err := json.Unmarshal(recorder.Body.Bytes(), &d); err != nil {
+		t.Fatal(err)
+	}
+
+	return d
+}
+
+func TestDiff(t *testing.T) {
+	before := `interface org.example.test
+type Item (name: string)
+method Get(name: string) -> (item: Item)
+method Remove(name: string) -> ()
+error NotFound ()
+error Gone ()
+`
+	after := `interface org.example.test
+type Item (name: string, count: int)
+method Get(name: string) -> (item: Item)
+method Add(item: Item) -> ()
+error NotFound (name: string)
+error Full ()
+`
+
+	d := diff(t, before, after)
+
+	if len(d.Types.Changed) != 1 || d.Types.Changed[0].Name != "Item" {
+		t.Errorf("got changed types %v, expected Item", d.Types.Changed)
+	}
+	if len(d.Methods.Added) != 1 || d.Methods.Added[0] != "Add" {
+		t.Errorf("got added methods %v, expected Add", d.Methods.Added)
+	}
+	if len(d.Methods.Removed) != 1 || d.Methods.Removed[0] != "Remove" {
+		t.Errorf("got removed methods %v, expected Remove", d.Methods.Removed)
+	}
+	if len(d.Methods.Changed) != 0 {
+		t.Errorf("got changed methods %v, expected none", d.Methods.Changed)
+	}
+
+	expected := memberChange{Name: "NotFound", Type: &signatureChange{"()", "(name: string)"}}
+	if len(d.Errors.Changed) != 1 || d.Errors.Changed[0].Name != expected.Name || *d.Errors.Changed[0].Type != *expected.Type {
+		t.Errorf("got changed errors %v, expected %v", d.Errors.Changed, expected)
+	}
+	if len(d.Errors.Added) != 1 || d.Errors.Added[0] != "Full" {
+		t.Errorf("got added errors %v, expected Full", d.Errors.Added)
+	}
+	if len(d.Errors.Removed) != 1 || d.Errors.Removed[0] != "Gone" {
+		t.Errorf("got removed errors %v, expected Gone", d.Errors.Removed)
+	}
+}
+
+func TestDiffErrorWithoutType(t *testing.T) {
+	i := &idl.IDL{Members: []interface{}{&idl.Error{Name: "Untyped"}}}
+
+	members := diffMembers(i, "error")
+	if len(members) != 1 || members[0].signatures[0] != "()" {
+		t.Errorf("got %v, expected Untyped with an empty struct", members)
+	}
+}
+
+func TestDiffAddress(t *testing.T) {
+	address := startTestService(t)
+	server := startProxy(t)
+
+	diffRequest := `{"old": {"interface": "org.example.test", "address": "` + address + `"}, "new": {"interface": "org.example.test"}}`
+	response, body := post(t, server.URL+"/diff", diffRequest)
+	checkStatus(t, response, body, http.StatusForbidden)
+	if !strings.Contains(body, "org.varlink.http.AddressNotAllowed") {
+		t.Errorf("got %s, expected org.varlink.http.AddressNotAllowed", body)
+	}
+
+	t.Setenv("CALL_ADDRESSES", address)
+	server = startProxy(t)
+
+	response, body = post(t, server.URL+"/diff", diffRequest)
+	checkStatus(t, response, body, http.StatusOK)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestDocs(t *testing.T) {
+	setFlag(t, "docs", "true")
+	startTestService(t)
+	server := startProxy(t)
+
+	response, body := get(t, server.URL+"/docs?interface=org.example.test")
+	checkStatus(t, response, body, http.StatusOK)
+	if !strings.Contains(body, `data-spec-url="`+server.URL+`/interface/org.example.test/openapi.json"`) {
+		t.Errorf("spec URL missing:\n%s", body)
+	}
+
+	// the page must work without access to other hosts
+	for _, match := range regexp.MustCompile(`(?:src|href)="([^"]*)"`).FindAllStringSubmatch(body, -1) {
+		if strings.Contains(match[1], "//") {
+			t.Errorf("page loads %s from another host", match[1])
+		}
+	}
+
+	response, body = get(t, server.URL+"/docs.js")
+	checkStatus(t, response, body, http.StatusOK)
+	if !strings.Contains(body, "data-spec-url") {
+		t.Errorf("got unexpected script:\n%s", body)
+	}
+}
+
+func TestDocsDisabled(t *testing.T) {
+	startTestService(t)
+	server := startProxy(t)
+
+	for _, path := range []string{"/docs", "/docs.js"} {
+		response, body := get(t, server.URL+path)
+		checkStatus(t, response, body, http.StatusNotFound)
+	}
+}
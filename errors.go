@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/varlink/go/varlink"
+)
+
+var serviceName = flag.String("service-name", "org.varlink.http", "name errors of the proxy itself `name`.Error instead of org.varlink.http.Error")
+var verboseErrors = flag.Bool("verbose-errors", false, "include the service address, method and raw reply in errors of calls (exposes internals, for debugging only)")
+
+// errorBody is the JSON representation of all error replies.
+type errorBody struct {
+	Error      string      `json:"error"`
+	Parameters interface{} `json:"parameters,omitempty"`
+	Debug      *callDebug  `json:"debug,omitempty"`
+}
+
+// callDebug describes a failed call with -verbose-errors.
+type callDebug struct {
+	Method  string `json:"method"`
+	Address string `json:"address,omitempty"`
+	Cause   string `json:"cause"`
+	Reply   string `json:"reply,omitempty"`
+}
+
+// wantsHTML returns true if the client is a browser, which expects a human
+// readable error page instead of a JSON body.
+func wantsHTML(request *http.Request) bool {
+	return negotiate(request, []string{"application/json", "text/html"}) == "text/html"
+}
+
+// writeError writes an error reply with the given varlink-style error name
+// and parameters.
+func writeError(writer http.ResponseWriter, request *http.Request, status int, name string, parameters interface{}) {
+	writeErrorBody(writer, request, status, errorBody{Error: name, Parameters: parameters})
+}
+
+// statusErrors names the errors of the proxy itself, which are not
+// otherwise named, after their status code.
+var statusErrors = map[int]string{
+	http.StatusBadRequest:            "BadRequest",
+	http.StatusUnauthorized:          "Unauthorized",
+	http.StatusForbidden:             "Forbidden",
+	http.StatusNotFound:              "NotFound",
+	http.StatusMethodNotAllowed:      "MethodNotAllowed",
+	http.StatusRequestEntityTooLarge: "RequestTooLarge",
+	http.StatusUnsupportedMediaType:  "UnsupportedMediaType",
+	http.StatusTooManyRequests:       "TooManyRequests",
+	http.StatusInternalServerError:   "InternalError",
+	http.StatusNotImplemented:        "NotImplemented",
+	http.StatusBadGateway:            "BadGateway",
+	http.StatusServiceUnavailable:    "Unavailable",
+	http.StatusGatewayTimeout:        "Timeout",
+}
+
+// statusError returns the name of an error of the proxy itself with the
+// given status code.
+func statusError(status int) string {
+	name, ok := statusErrors[status]
+	if !ok {
+		name = "BadRequest"
+		if status >= 500 {
+			name = "InternalError"
+		}
+	}
+
+	return "org.varlink.http." + name
+}
+
+// errorName returns name, with -service-name in place of org.varlink.http
+// for errors of the proxy itself.
+func errorName(name string) string {
+	if strings.HasPrefix(name, "org.varlink.http.") {
+		return *serviceName + strings.TrimPrefix(name, "org.varlink.http")
+	}
+
+	return name
+}
+
+func writeErrorBody(writer http.ResponseWriter, request *http.Request, status int, body errorBody) {
+	body.Error = errorName(body.Error)
+	if wantsHTML(request) {
+		writeErrorPage(writer, status, body)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	writer.Header().Set("X-Content-Type-Options", "nosniff")
+	writer.WriteHeader(status)
+	newEncoder(writer, request).Encode(body)
+}
+
+// writeErrorPage writes an error reply as the error.html page. Errors of the
+// bridge itself show their message, all others their name and parameters.
+func writeErrorPage(writer http.ResponseWriter, status int, body errorBody) {
+	data := map[string]interface{}{
+		"Status":     status,
+		"StatusText": http.StatusText(status),
+		"Error":      body.Error,
+	}
+	if parameters, ok := body.Parameters.(map[string]string); ok && len(parameters) == 1 && parameters["message"] != "" {
+		data["Message"] = parameters["message"]
+	} else if body.Parameters != nil {
+		b, _ := json.MarshalIndent(body.Parameters, "", "  ")
+		data["Parameters"] = string(b)
+	}
+	if body.Debug != nil {
+		b, _ := json.MarshalIndent(body.Debug, "", "  ")
+		data["Debug"] = string(b)
+	}
+
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	writer.Header().Set("X-Content-Type-Options", "nosniff")
+	writer.WriteHeader(status)
+	if err := executeTemplate(writer, "error.html", data); err != nil {
+		log.Print(err.Error())
+	}
+}
+
+// httpError writes an error reply for errors of the bridge itself.
+func httpError(writer http.ResponseWriter, request *http.Request, message string, status int) {
+	writeError(writer, request, status, statusError(status), map[string]string{"message": message})
+}
+
+// varlinkError writes an error reply for a varlink error.
+func varlinkError(writer http.ResponseWriter, request *http.Request, verr *varlink.Error, status int) {
+	writeError(writer, request, status, verr.Name, verr.Parameters)
+}
+
+// callError writes an error reply for an error which occurred while
+// resolving an interface or talking to a service. Details of errors which
+// are not varlink errors are only logged.
+func callError(writer http.ResponseWriter, request *http.Request, err error) {
+	status := errorStatus(err)
+
+	var verr *varlink.Error
+	if errors.As(err, &verr) {
+		varlinkError(writer, request, verr, status)
+		return
+	}
+
+	httpError(writer, request, http.StatusText(status), status)
+	log.Print(err.Error())
+}
+
+// callErrorDebug writes an error reply like callError. With
+// -verbose-errors, the reply includes debug, completed with the error.
+func callErrorDebug(writer http.ResponseWriter, request *http.Request, err error, debug callDebug) {
+	if !*verboseErrors {
+		callError(writer, request, err)
+		return
+	}
+
+	status := errorStatus(err)
+	body := errorBody{Error: statusError(status), Parameters: map[string]string{"message": http.StatusText(status)}}
+
+	var verr *varlink.Error
+	if errors.As(err, &verr) {
+		body = errorBody{Error: verr.Name, Parameters: verr.Parameters}
+	} else {
+		log.Print(err.Error())
+	}
+
+	debug.Cause = err.Error()
+	body.Debug = &debug
+	writeErrorBody(writer, request, status, body)
+}
+
+// varlinkErrorStatus returns the HTTP status code for a varlink error
+// returned by the resolver or a method call. Errors caused by the request
+// map to 4xx codes, errors of the service to 5xx codes.
+func varlinkErrorStatus(name string) int {
+	switch name {
+	case "org.varlink.service.InterfaceNotFound", "org.varlink.service.MethodNotFound",
+		"org.varlink.resolver.InterfaceNotFound":
+		return http.StatusNotFound
+
+	case "org.varlink.http.InterfaceNotAllowed", "org.varlink.http.AddressNotAllowed",
+		"org.varlink.service.PermissionDenied":
+		return http.StatusForbidden
+
+	case "org.varlink.service.MethodNotImplemented", "org.varlink.http.UnsupportedTransport",
+		"org.varlink.http.IntrospectionNotSupported":
+		return http.StatusNotImplemented
+
+	case "org.varlink.service.InvalidParameter", "org.varlink.service.ExpectedMore",
+		"org.varlink.http.InvalidAddress", "org.varlink.http.InvalidMethod",
+		"org.varlink.http.InvalidInterface":
+		return http.StatusBadRequest
+
+	case "org.varlink.http.InterfaceMismatch", "org.varlink.http.InvalidFollowPath",
+		"org.varlink.http.EmptyDescription", "org.varlink.http.InvalidServiceDescription":
+		return http.StatusBadGateway
+
+	case "org.varlink.http.TooManyReplies":
+		return http.StatusRequestEntityTooLarge
+
+	case "org.varlink.http.TooManyConnections":
+		return http.StatusServiceUnavailable
+	}
+
+	if strings.HasPrefix(name, "org.varlink.service.") {
+		return http.StatusBadGateway
+	}
+
+	// errors defined by the interface are replies to the request
+	return http.StatusBadRequest
+}
+
+// errorStatus returns the HTTP status code for an error which occurred
+// while resolving an interface or talking to a service.
+func errorStatus(err error) int {
+	var verr *varlink.Error
+	if errors.As(err, &verr) {
+		return varlinkErrorStatus(verr.Name)
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return http.StatusGatewayTimeout
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return http.StatusBadGateway
+	}
+
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, varlink.ErrMessageTooLarge) {
+		return http.StatusBadGateway
+	}
+
+	return http.StatusInternalServerError
+}
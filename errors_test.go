@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+// startTruncatingService starts a service which answers the first call with
+// reply, without the terminating NUL byte, and closes the connection. It
+// returns the address of the service.
+func startTruncatingService(t *testing.T, reply string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "service")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		listener.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if _, err := bufio.NewReader(conn).ReadBytes(0); err == nil {
+					conn.Write([]byte(reply))
+				}
+			}()
+		}
+	}()
+
+	return "unix:" + path
+}
+
+func TestVerboseErrorsTruncatedReply(t *testing.T) {
+	startResolver(t, map[string]string{"org.example.truncated": startTruncatingService(t, `{"parameters": {"a": 1}}`)}, nil)
+	setFlag(t, "verbose-errors", "true")
+	setFlag(t, "max-reply-size", "0")
+	server := startProxy(t)
+
+	response, body := post(t, server.URL+"/", `{"method": "org.example.truncated.Get"}`)
+	if response.StatusCode < 500 {
+		t.Fatalf("got %d %s, expected a server error", response.StatusCode, body)
+	}
+
+	var reply errorBody
+	if err := json.Unmarshal([]byte(body), &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Debug == nil || reply.Debug.Reply != `{"parameters": {"a": 1}}` {
+		t.Errorf("got %s, expected the whole reply", body)
+	}
+}
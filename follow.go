@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/varlink/go/varlink"
+)
+
+// invalidFollowPath is returned if a reply does not contain an address at
+// the path given with ?follow=.
+func invalidFollowPath(method string, path string) *varlink.Error {
+	return &varlink.Error{
+		Name:       "org.varlink.http.InvalidFollowPath",
+		Parameters: map[string]string{"method": method, "path": path},
+	}
+}
+
+// replyAddress calls the method of call and returns the string at the
+// dot-separated path in its reply.
+func replyAddress(call methodCall, path string) (string, error) {
+	raw, err := callReply(call)
+	if err != nil {
+		return "", err
+	}
+
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return "", invalidFollowPath(call.Method, path)
+	}
+
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return "", invalidFollowPath(call.Method, path)
+		}
+		value = object[name]
+	}
+
+	address, ok := value.(string)
+	if !ok {
+		return "", invalidFollowPath(call.Method, path)
+	}
+
+	return address, nil
+}
+
+// followCall calls in.Method, takes the address of a service from its reply
+// at path, and calls in.Follow on that service. The reply of the second
+// call is returned. Both calls are admitted like any other call, the
+// address must match FOLLOW_ADDRESSES, and the service at the address must
+// implement the interface of the second call.
+func followCall(writer http.ResponseWriter, request *http.Request, in methodCall, path string, flags uint64) {
+	if in.Follow == nil {
+		varlinkError(writer, request, invalidParameter("follow"), http.StatusBadRequest)
+		return
+	}
+	if len(followAddresses) == 0 {
+		httpError(writer, request, "Following addresses is not enabled", http.StatusForbidden)
+		return
+	}
+
+	iface, ok := admitCall(writer, request, in.Method)
+	if !ok {
+		return
+	}
+	address, err := replyAddress(in, path)
+	callLimiter.release(iface)
+	if err != nil {
+		callError(writer, request, err)
+		return
+	}
+
+	if !followAddresses.match(address) {
+		varlinkError(writer, request, addressNotAllowed(address), http.StatusForbidden)
+		return
+	}
+
+	follow := *in.Follow
+	follow.Address = address
+	follow.followed = true
+	callMethod(writer, request, follow, flags)
+}
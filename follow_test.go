@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/varlink/go/varlink"
+)
+
+const followRequest = `{"method": "org.example.broker.Get", "follow": {"method": "org.example.test.Echo", "parameters": {"text": "followed", "number": 1}}}`
+
+// startBroker starts a broker returning the address of a service
+// implementing org.example.test, and a resolver for the broker. It returns
+// the address of the other service.
+func startBroker(t *testing.T) string {
+	t.Helper()
+
+	worker := startService(t, newTestInterface())
+	broker := startService(t, &testInterface{
+		name:        "org.example.broker",
+		description: "interface org.example.broker\nmethod Get() -> (worker: (address: string))\n",
+		methods: map[string]func(c varlink.Call) error{
+			"Get": func(c varlink.Call) error {
+				return c.Reply(map[string]interface{}{
+					"worker": map[string]string{"address": worker},
+				})
+			},
+		},
+	})
+	startResolver(t, map[string]string{"org.example.broker": broker}, nil)
+
+	return worker
+}
+
+func TestFollow(t *testing.T) {
+	worker := startBroker(t)
+	t.Setenv("FOLLOW_ADDRESSES", worker)
+	server := startProxy(t)
+
+	response, body := post(t, server.URL+"/?follow=worker.address", followRequest)
+	checkStatus(t, response, body, http.StatusOK)
+
+	if expected := `{"parameters":{"number":1,"text":"followed"}}` + "\n"; body != expected {
+		t.Errorf("got %q, expected %q", body, expected)
+	}
+}
+
+func TestFollowDisabled(t *testing.T) {
+	startBroker(t)
+	t.Setenv("FOLLOW_ADDRESSES", "")
+	server := startProxy(t)
+
+	response, body := post(t, server.URL+"/?follow=worker.address", followRequest)
+	checkStatus(t, response, body, http.StatusForbidden)
+}
+
+func TestFollowAddressNotAllowed(t *testing.T) {
+	startBroker(t)
+	t.Setenv("FOLLOW_ADDRESSES", "unix:/run/org.example.worker-*")
+	server := startProxy(t)
+
+	response, body := post(t, server.URL+"/?follow=worker.address", followRequest)
+	checkStatus(t, response, body, http.StatusForbidden)
+
+	if !strings.Contains(body, "org.varlink.http.AddressNotAllowed") {
+		t.Errorf("got %s, expected org.varlink.http.AddressNotAllowed", body)
+	}
+}
+
+func TestFollowInvalidPath(t *testing.T) {
+	worker := startBroker(t)
+	t.Setenv("FOLLOW_ADDRESSES", worker)
+	server := startProxy(t)
+
+	for _, path := range []string{"worker", "worker.name", "address"} {
+		response, body := post(t, server.URL+"/?follow="+path, followRequest)
+		checkStatus(t, response, body, http.StatusBadGateway)
+	}
+}
+
+func TestFollowRateLimit(t *testing.T) {
+	worker := startBroker(t)
+	t.Setenv("FOLLOW_ADDRESSES", worker)
+	t.Setenv("RATE_LIMITS", "org.example.broker=1/h")
+	server := startProxy(t)
+
+	response, body := post(t, server.URL+"/?follow=worker.address", followRequest)
+	checkStatus(t, response, body, http.StatusOK)
+
+	response, body = post(t, server.URL+"/?follow=worker.address", followRequest)
+	checkStatus(t, response, body, http.StatusTooManyRequests)
+	if response.Header.Get("Retry-After") == "" {
+		t.Errorf("missing Retry-After header")
+	}
+}
+
+func TestFollowChecksMethods(t *testing.T) {
+	worker := startBroker(t)
+	t.Setenv("FOLLOW_ADDRESSES", worker)
+	setFlag(t, "check-methods", "true")
+	server := startProxy(t)
+
+	response, body := post(t, server.URL+"/?follow=worker.address", `{"method": "org.example.broker.Unknown", "follow": {"method": "org.example.test.Nothing"}}`)
+	checkStatus(t, response, body, http.StatusNotFound)
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/varlink/go/varlink"
+	"github.com/varlink/go/varlink/idl"
+)
+
+// resolveType follows aliases until it reaches a type which is not an alias.
+// It returns nil for unknown or recursive aliases.
+func resolveType(i *idl.IDL, t *idl.Type) *idl.Type {
+	seen := make(map[string]bool)
+	for t != nil && t.Kind == idl.TypeAlias {
+		if seen[t.Alias] {
+			return nil
+		}
+		seen[t.Alias] = true
+
+		var next *idl.Type
+		for _, alias := range i.Aliases {
+			if alias.Name == t.Alias {
+				next = alias.Type
+				break
+			}
+		}
+		t = next
+	}
+
+	return t
+}
+
+func invalidParameter(name string) *varlink.Error {
+	return &varlink.Error{
+		Name:       "org.varlink.service.InvalidParameter",
+		Parameters: map[string]string{"parameter": name},
+	}
+}
+
+// coerceString converts a string value to a value of type t.
+func coerceString(i *idl.IDL, t *idl.Type, s string) (interface{}, error) {
+	t = resolveType(i, t)
+	if t == nil {
+		return nil, fmt.Errorf("unknown type")
+	}
+
+	switch t.Kind {
+	case idl.TypeBool:
+		return strconv.ParseBool(s)
+
+	case idl.TypeInt:
+		return strconv.ParseInt(s, 10, 64)
+
+	case idl.TypeFloat:
+		return strconv.ParseFloat(s, 64)
+
+	case idl.TypeString:
+		return s, nil
+
+	case idl.TypeEnum:
+		for _, field := range t.Fields {
+			if field.Name == s {
+				return s, nil
+			}
+		}
+		return nil, fmt.Errorf("invalid enum value %q", s)
+
+	case idl.TypeMaybe:
+		if s == "" {
+			return nil, nil
+		}
+		return coerceString(i, t.ElementType, s)
+	}
+
+	// arrays, maps, structs and objects are given as JSON
+	var v interface{}
+	err := json.Unmarshal([]byte(s), &v)
+	return v, err
+}
+
+// coerceValues converts the values of a form field to a value of type t.
+// Repeated fields form an array.
+func coerceValues(i *idl.IDL, t *idl.Type, values []string) (interface{}, error) {
+	if resolved := resolveType(i, t); resolved != nil && resolved.Kind == idl.TypeArray && len(values) > 1 {
+		array := make([]interface{}, 0, len(values))
+		for _, s := range values {
+			v, err := coerceString(i, resolved.ElementType, s)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, v)
+		}
+		return array, nil
+	}
+
+	return coerceString(i, t, values[0])
+}
+
+// coerceValue converts strings in v, which is the value of the parameter
+// named name, to values of type t. Other values are kept as they are.
+func coerceValue(i *idl.IDL, t *idl.Type, name string, v interface{}) (interface{}, error) {
+	t = resolveType(i, t)
+	if t == nil {
+		return v, nil
+	}
+
+	switch value := v.(type) {
+	case string:
+		switch t.Kind {
+		case idl.TypeString, idl.TypeObject:
+			return value, nil
+
+		case idl.TypeMaybe:
+			return coerceValue(i, t.ElementType, name, value)
+		}
+
+		coerced, err := coerceString(i, t, value)
+		if err != nil {
+			return nil, invalidParameter(name)
+		}
+		return coerced, nil
+
+	case map[string]interface{}:
+		switch t.Kind {
+		case idl.TypeMaybe:
+			return coerceValue(i, t.ElementType, name, value)
+
+		case idl.TypeStruct:
+			for _, field := range t.Fields {
+				if fieldValue, ok := value[field.Name]; ok {
+					coerced, err := coerceValue(i, field.Type, name+"."+field.Name, fieldValue)
+					if err != nil {
+						return nil, err
+					}
+					value[field.Name] = coerced
+				}
+			}
+
+		case idl.TypeMap:
+			for key, element := range value {
+				coerced, err := coerceValue(i, t.ElementType, name+"."+key, element)
+				if err != nil {
+					return nil, err
+				}
+				value[key] = coerced
+			}
+		}
+
+	case []interface{}:
+		switch t.Kind {
+		case idl.TypeMaybe:
+			return coerceValue(i, t.ElementType, name, value)
+
+		case idl.TypeArray:
+			for n, element := range value {
+				coerced, err := coerceValue(i, t.ElementType, fmt.Sprintf("%s[%d]", name, n), element)
+				if err != nil {
+					return nil, err
+				}
+				value[n] = coerced
+			}
+		}
+	}
+
+	return v, nil
+}
+
+// coerceParameters converts string values of the parameters of call to the
+// types of the method's input parameters, for clients which can only send
+// strings. A value which cannot be converted fails with InvalidParameter
+// naming it.
+func coerceParameters(call methodCall) (interface{}, error) {
+	parameters, ok := call.Parameters.(map[string]interface{})
+	if !ok {
+		return call.Parameters, nil
+	}
+
+	i, in, err := methodInput(call.Method, call.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, field := range in.Fields {
+		if v, ok := parameters[field.Name]; ok {
+			coerced, err := coerceValue(i, field.Type, field.Name, v)
+			if err != nil {
+				return nil, err
+			}
+			parameters[field.Name] = coerced
+		}
+	}
+
+	return parameters, nil
+}
+
+// methodInput returns the description of the interface of method, as
+// served at address or by the service implementing it, and the struct type
+// of the method's input parameters.
+func methodInput(method string, address string) (*idl.IDL, *idl.Type, error) {
+	if err := checkMethodName(method); err != nil {
+		return nil, nil, err
+	}
+	dot := strings.LastIndex(method, ".")
+
+	var i *idl.IDL
+	var err error
+	if address != "" {
+		i, err = fetchDescription(method[:dot], address)
+	} else {
+		i, err = interfaces.describe(method[:dot])
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var m *idl.Method
+	for _, candidate := range i.Methods {
+		if candidate.Name == method[dot+1:] {
+			m = candidate
+			break
+		}
+	}
+	if m == nil {
+		return nil, nil, &varlink.Error{
+			Name:       "org.varlink.service.MethodNotFound",
+			Parameters: map[string]string{"method": method},
+		}
+	}
+
+	in := resolveType(i, m.In)
+	if in == nil || in.Kind != idl.TypeStruct {
+		return nil, nil, fmt.Errorf("method %s has no input parameters struct", method)
+	}
+
+	return i, in, nil
+}
+
+// positionalParameters converts parameters given as an array to an object,
+// naming the values after the input parameters of the method in declaration
+// order.
+func positionalParameters(call methodCall, values []interface{}) (map[string]interface{}, error) {
+	_, in, err := methodInput(call.Method, call.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(values) != len(in.Fields) {
+		return nil, &varlink.Error{
+			Name: "org.varlink.service.InvalidParameter",
+			Parameters: map[string]string{
+				"parameter": "parameters",
+				"message":   fmt.Sprintf("expected %d positional parameters, got %d", len(in.Fields), len(values)),
+			},
+		}
+	}
+
+	parameters := make(map[string]interface{}, len(values))
+	for n, field := range in.Fields {
+		parameters[field.Name] = values[n]
+	}
+
+	return parameters, nil
+}
+
+// formCall reads a method call from a form. The "method" field names the
+// method, all other fields are its parameters, which are converted to the
+// types declared in the interface description.
+func formCall(request *http.Request) (string, interface{}, error) {
+	err := request.ParseForm()
+	if err != nil {
+		return "", nil, err
+	}
+
+	method := request.PostForm.Get("method")
+	i, in, err := methodInput(method, "")
+	if err != nil {
+		return "", nil, err
+	}
+
+	parameters := make(map[string]interface{})
+	for _, field := range in.Fields {
+		values, ok := request.PostForm[field.Name]
+		if !ok || len(values) == 0 {
+			continue
+		}
+
+		v, err := coerceValues(i, field.Type, values)
+		if err != nil {
+			return "", nil, invalidParameter(field.Name)
+		}
+		parameters[field.Name] = v
+	}
+
+	return method, parameters, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var accessLog = flag.Bool("access-log", false, "log every request")
+
+// trustedProxies lists the networks of reverse proxies whose X-Forwarded-*
+// headers are used. It is set from the TRUSTED_PROXIES environment variable.
+var trustedProxies []*net.IPNet
+
+func parseTrustedProxies(s string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, cidr := range strings.Split(s, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TRUSTED_PROXIES: %s", err)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+func trustedProxy(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+
+	ip := net.ParseIP(strings.TrimSpace(host))
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// withForwarded takes the client address, scheme and host from the
+// X-Forwarded-For, X-Forwarded-Proto and X-Forwarded-Host headers of
+// requests sent by trusted proxies. The headers of other peers are ignored.
+func withForwarded(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if !trustedProxy(request.RemoteAddr) {
+			handler.ServeHTTP(writer, request)
+			return
+		}
+
+		request = request.Clone(request.Context())
+
+		// The last address was added by the closest proxy. Walk back
+		// through the proxies to the first address not added by a
+		// trusted one.
+		if forwarded := request.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+			addrs := strings.Split(strings.Join(forwarded, ","), ",")
+			for n := len(addrs) - 1; n >= 0; n-- {
+				addr := strings.TrimSpace(addrs[n])
+				if addr == "" {
+					continue
+				}
+				request.RemoteAddr = addr
+				if !trustedProxy(addr) {
+					break
+				}
+			}
+		}
+
+		if proto := request.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+			request.URL.Scheme = proto
+		}
+
+		if host := request.Header.Get("X-Forwarded-Host"); host != "" {
+			request.Host = host
+		}
+
+		handler.ServeHTTP(writer, request)
+	})
+}
+
+// baseURL returns the absolute URL below which the client reached the
+// proxy.
+func baseURL(request *http.Request) string {
+	scheme := request.URL.Scheme
+	if scheme == "" {
+		scheme = "http"
+		if request.TLS != nil {
+			scheme = "https"
+		}
+	}
+
+	return scheme + "://" + request.Host + *basePath
+}
+
+// statusWriter records the status code of a reply.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush keeps server-sent events working through the wrapper.
+func (w *statusWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// withAccessLog logs every request with its client address, status and
+// duration.
+func withAccessLog(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+		w := &statusWriter{ResponseWriter: writer}
+
+		handler.ServeHTTP(w, request)
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+
+		log.Printf("%s %s %s %d %s", request.RemoteAddr, request.Method, request.URL.RequestURI(), w.status, time.Since(start))
+	})
+}
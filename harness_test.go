@@ -0,0 +1,435 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/varlink/go/varlink"
+)
+
+// testInterface is an interface of a test service. Calls are dispatched to
+// the function in methods with the method's name.
+type testInterface struct {
+	name        string
+	description string
+	methods     map[string]func(c varlink.Call) error
+}
+
+func (i *testInterface) VarlinkDispatch(c varlink.Call, method string) error {
+	f, ok := i.methods[method]
+	if !ok {
+		return c.ReplyMethodNotFound(method)
+	}
+
+	return f(c)
+}
+
+func (i *testInterface) VarlinkGetName() string {
+	return i.name
+}
+
+func (i *testInterface) VarlinkGetDescription() string {
+	return i.description
+}
+
+const testDescription = `# Interface of the test service.
+interface org.example.test
+
+type Item (name: string, count: int)
+
+# Returns its parameters.
+method Echo(text: string, number: int) -> (text: string, number: int)
+
+# Replies count times, at least once, if called with more, otherwise once.
+method Count(count: int) -> (i: int)
+
+method Nothing() -> ()
+
+method Fail() -> ()
+
+error Failed (reason: string)
+`
+
+// newTestInterface returns an implementation of org.example.test. Tests
+// can replace or add methods before starting the service.
+func newTestInterface() *testInterface {
+	return &testInterface{
+		name:        "org.example.test",
+		description: testDescription,
+		methods: map[string]func(c varlink.Call) error{
+			"Echo": func(c varlink.Call) error {
+				var parameters json.RawMessage
+				if err := c.GetParameters(&parameters); err != nil {
+					return c.ReplyInvalidParameter("parameters")
+				}
+				return c.Reply(parameters)
+			},
+			"Count": func(c varlink.Call) error {
+				var in struct {
+					Count int `json:"count"`
+				}
+				if err := c.GetParameters(&in); err != nil {
+					return c.ReplyInvalidParameter("count")
+				}
+				for i := 0; i == 0 || i < in.Count; i++ {
+					c.Continues = c.WantsMore() && i < in.Count-1
+					if err := c.Reply(map[string]int{"i": i}); err != nil {
+						return err
+					}
+					if !c.WantsMore() {
+						break
+					}
+				}
+				return nil
+			},
+			"Nothing": func(c varlink.Call) error {
+				// sends a reply without parameters
+				return c.Reply(nil)
+			},
+			"Fail": func(c varlink.Call) error {
+				return c.ReplyError("org.example.test.Failed", map[string]string{"reason": "test"})
+			},
+		},
+	}
+}
+
+// startService serves ifaces on a unix socket in a temporary directory
+// until the test ends, and returns its address.
+func startService(t *testing.T, ifaces ...*testInterface) string {
+	t.Helper()
+
+	s, err := varlink.NewService("Varlink", "Test Service", "1", "https://varlink.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, iface := range ifaces {
+		if err := s.RegisterInterface(iface); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	address := "unix:" + filepath.Join(t.TempDir(), "service")
+	go s.Listen(address, 0)
+	t.Cleanup(s.Shutdown)
+
+	// wait until the service accepts connections
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		c, err := varlink.NewConnection(address)
+		if err == nil {
+			c.Close()
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("service at %s did not start: %s", address, err)
+		}
+	}
+
+	return address
+}
+
+const testResolverDescription = `interface org.varlink.resolver
+
+method GetInfo() -> (
+  vendor: string,
+  product: string,
+  version: string,
+  url: string,
+  interfaces: []string
+)
+
+method Resolve(interface: string) -> (address: string)
+
+error InterfaceNotFound (interface: string)
+`
+
+// startResolver starts a resolver returning the addresses of the
+// interfaces in addresses, and uses it until the test ends. GetInfo lists
+// names, or the interfaces in addresses if names is nil.
+func startResolver(t *testing.T, addresses map[string]string, names []string) {
+	t.Helper()
+
+	if names == nil {
+		for name := range addresses {
+			names = append(names, name)
+		}
+	}
+
+	address := startService(t, &testInterface{
+		name:        "org.varlink.resolver",
+		description: testResolverDescription,
+		methods: map[string]func(c varlink.Call) error{
+			"GetInfo": func(c varlink.Call) error {
+				return c.Reply(resolverInfo{
+					Vendor:     "Varlink",
+					Product:    "Test Resolver",
+					Version:    "1",
+					URL:        "https://varlink.org",
+					Interfaces: names,
+				})
+			},
+			"Resolve": func(c varlink.Call) error {
+				var in struct {
+					Interface string `json:"interface"`
+				}
+				if err := c.GetParameters(&in); err != nil {
+					return c.ReplyInvalidParameter("interface")
+				}
+				address, ok := addresses[in.Interface]
+				if !ok {
+					return c.ReplyError("org.varlink.resolver.InterfaceNotFound", map[string]string{"interface": in.Interface})
+				}
+				return c.Reply(map[string]string{"address": address})
+			},
+		},
+	})
+
+	setFlag(t, "resolver-address", address)
+}
+
+// startTestService starts a service implementing org.example.test and a
+// resolver for it, and returns the service's address.
+func startTestService(t *testing.T, ifaces ...*testInterface) string {
+	t.Helper()
+
+	if len(ifaces) == 0 {
+		ifaces = []*testInterface{newTestInterface()}
+	}
+	address := startService(t, ifaces...)
+
+	addresses := make(map[string]string)
+	for _, iface := range ifaces {
+		addresses[iface.name] = address
+	}
+	startResolver(t, addresses, nil)
+
+	return address
+}
+
+// setFlag sets the flag name to value until the test ends.
+func setFlag(t *testing.T, name string, value string) {
+	t.Helper()
+
+	f := flag.Lookup(name)
+	if f == nil {
+		t.Fatalf("no flag %s", name)
+	}
+	old := f.Value.String()
+	if err := f.Value.Set(value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		f.Value.Set(old)
+	})
+}
+
+// resetState closes all connections to services and forgets everything
+// cached about them, so no test sees the services of a previous one.
+func resetState() {
+	resolver.mutex.Lock()
+	if resolver.resolver != nil {
+		resolver.resolver.Close()
+		resolver.resolver = nil
+	}
+	resolver.mutex.Unlock()
+
+	resolverInfoCache.mutex.Lock()
+	resolverInfoCache.expires = time.Time{}
+	resolverInfoCache.mutex.Unlock()
+
+	interfaces.mutex.Lock()
+	interfaces.entries = make(map[string]idlCacheEntry)
+	interfaces.mutex.Unlock()
+
+	searches.mutex.Lock()
+	searches.results = make(map[string]searchResult)
+	searches.mutex.Unlock()
+
+	callRateLimiter.mutex.Lock()
+	callRateLimiter.buckets = make(map[string]*tokenBucket)
+	callRateLimiter.mutex.Unlock()
+
+	sessions.mutex.Lock()
+	tokens := make([]string, 0, len(sessions.sessions))
+	for token := range sessions.sessions {
+		tokens = append(tokens, token)
+	}
+	sessions.mutex.Unlock()
+	for _, token := range tokens {
+		sessions.end(token)
+	}
+
+	for pool.evict() {
+	}
+
+	if tracingExporter != nil {
+		tracingExporter.stop()
+		tracingExporter = nil
+	}
+}
+
+// startProxy serves the proxy with the current flags until the test ends.
+func startProxy(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	if err := loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	handler, err := newHandler()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(func() {
+		server.Close()
+		resetState()
+		waitForConnections(t)
+	})
+
+	return server
+}
+
+// waitForConnections waits until all connections to services are closed.
+// Handlers abandoned by -request-timeout still run after the server closed,
+// their connections must not be released into the limits of the next test.
+func waitForConnections(t *testing.T) {
+	t.Helper()
+
+	for start := time.Now(); openConnections.Value() > 0; time.Sleep(10 * time.Millisecond) {
+		// a late handler might have pooled its connection
+		for pool.evict() {
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Errorf("%d connections to services are still open", openConnections.Value())
+			return
+		}
+	}
+}
+
+// do sends request and returns the response with its body.
+func do(t *testing.T, request *http.Request) (*http.Response, string) {
+	t.Helper()
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return response, string(body)
+}
+
+// newRequest returns a request, failing the test if it is invalid.
+func newRequest(t *testing.T, method string, url string, body string) *http.Request {
+	t.Helper()
+
+	request, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "" {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	return request
+}
+
+// get sends a GET request accepting JSON.
+func get(t *testing.T, url string) (*http.Response, string) {
+	t.Helper()
+
+	request := newRequest(t, http.MethodGet, url, "")
+	request.Header.Set("Accept", "application/json")
+	return do(t, request)
+}
+
+// post sends a POST request with a JSON body.
+func post(t *testing.T, url string, body string) (*http.Response, string) {
+	t.Helper()
+
+	return do(t, newRequest(t, http.MethodPost, url, body))
+}
+
+// checkStatus fails the test if response does not have status.
+func checkStatus(t *testing.T, response *http.Response, body string, status int) {
+	t.Helper()
+
+	if response.StatusCode != status {
+		t.Fatalf("got status %d, expected %d: %s", response.StatusCode, status, body)
+	}
+}
+
+// newSlowInterface returns an interface with a method replying after the
+// given number of milliseconds.
+func newSlowInterface() *testInterface {
+	return &testInterface{
+		name:        "org.example.slow",
+		description: "interface org.example.slow\nmethod Sleep(milliseconds: int) -> ()\n",
+		methods: map[string]func(c varlink.Call) error{
+			"Sleep": func(c varlink.Call) error {
+				var in struct {
+					Milliseconds int `json:"milliseconds"`
+				}
+				if err := c.GetParameters(&in); err != nil {
+					return c.ReplyInvalidParameter("milliseconds")
+				}
+				time.Sleep(time.Duration(in.Milliseconds) * time.Millisecond)
+				return c.Reply(struct{}{})
+			},
+		},
+	}
+}
+
+// logBuffer collects the output of the log package.
+type logBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.String()
+}
+
+// captureLog collects the log output until the test ends.
+func captureLog(t *testing.T) *logBuffer {
+	b := &logBuffer{}
+	log.SetOutput(b)
+	t.Cleanup(func() {
+		log.SetOutput(os.Stderr)
+	})
+
+	return b
+}
+
+// getRange requests the given byte range of url.
+func getRange(t *testing.T, url string, byteRange string) (*http.Response, string) {
+	t.Helper()
+
+	request := newRequest(t, http.MethodGet, url, "")
+	request.Header.Set("Range", byteRange)
+	return do(t, request)
+}
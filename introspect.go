@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/varlink/go/varlink"
+	"github.com/varlink/go/varlink/idl"
+)
+
+// maxDescriptionSize limits the size of interface descriptions sent by
+// clients.
+const maxDescriptionSize = 1 << 20
+
+var typeKindNames = map[idl.TypeKind]string{
+	idl.TypeBool:   "bool",
+	idl.TypeInt:    "int",
+	idl.TypeFloat:  "float",
+	idl.TypeString: "string",
+	idl.TypeObject: "object",
+	idl.TypeArray:  "array",
+	idl.TypeMaybe:  "maybe",
+	idl.TypeMap:    "map",
+	idl.TypeStruct: "struct",
+	idl.TypeEnum:   "enum",
+	idl.TypeAlias:  "alias",
+}
+
+type jsonField struct {
+	Name string    `json:"name"`
+	Type *jsonType `json:"type,omitempty"`
+}
+
+// jsonType is the JSON representation of an idl.Type.
+type jsonType struct {
+	Kind    string      `json:"kind"`
+	Element *jsonType   `json:"element,omitempty"`
+	Alias   string      `json:"alias,omitempty"`
+	Fields  []jsonField `json:"fields,omitempty"`
+}
+
+// jsonMember is the JSON representation of a type alias, method or error
+// of an interface.
+type jsonMember struct {
+	Kind string    `json:"kind"`
+	Name string    `json:"name"`
+	Doc  string    `json:"doc,omitempty"`
+	Type *jsonType `json:"type,omitempty"`
+	In   *jsonType `json:"in,omitempty"`
+	Out  *jsonType `json:"out,omitempty"`
+
+	// Inputs describes the fields of In flatly, for generating forms.
+	Inputs []jsonInput `json:"inputs,omitempty"`
+
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// Streaming is set for methods annotated with @stream, which are
+	// meant to be called with "more".
+	Streaming bool `json:"streaming,omitempty"`
+}
+
+// jsonInput describes a method input field by the JSON type of its value,
+// with aliases resolved.
+type jsonInput struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"`
+	Variants []string `json:"variants,omitempty"`
+	Optional bool     `json:"optional,omitempty"`
+}
+
+// jsonInterface is the JSON representation of an idl.IDL. Members are kept
+// in the order they are declared in the interface description.
+type jsonInterface struct {
+	Name    string       `json:"name"`
+	Doc     string       `json:"doc,omitempty"`
+	Members []jsonMember `json:"members"`
+}
+
+// orderedObject is a JSON object which keeps its keys in the order they were
+// added, used for struct fields which would otherwise be sorted by name.
+type orderedObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newOrderedObject() *orderedObject {
+	return &orderedObject{values: make(map[string]interface{})}
+}
+
+func (o *orderedObject) set(key string, value interface{}) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+func (o *orderedObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+
+	b.WriteByte('{')
+	for n, key := range o.keys {
+		if n > 0 {
+			b.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteByte('}')
+
+	return b.Bytes(), nil
+}
+
+func newJSONType(t *idl.Type) *jsonType {
+	if t == nil {
+		return nil
+	}
+
+	j := &jsonType{
+		Kind:    typeKindNames[t.Kind],
+		Element: newJSONType(t.ElementType),
+		Alias:   t.Alias,
+	}
+	for _, field := range t.Fields {
+		j.Fields = append(j.Fields, jsonField{
+			Name: field.Name,
+			Type: newJSONType(field.Type),
+		})
+	}
+
+	return j
+}
+
+func newJSONInput(i *idl.IDL, field idl.TypeField) jsonInput {
+	input := jsonInput{Name: field.Name}
+
+	t := resolveType(i, field.Type)
+	if t != nil && t.Kind == idl.TypeMaybe {
+		input.Optional = true
+		t = resolveType(i, t.ElementType)
+	}
+	if t == nil {
+		return input
+	}
+
+	switch t.Kind {
+	case idl.TypeBool:
+		input.Type = "boolean"
+
+	case idl.TypeInt:
+		input.Type = "integer"
+
+	case idl.TypeFloat:
+		input.Type = "number"
+
+	case idl.TypeString:
+		input.Type = "string"
+
+	case idl.TypeArray:
+		input.Type = "array"
+
+	case idl.TypeEnum:
+		input.Type = "enum"
+		for _, variant := range t.Fields {
+			input.Variants = append(input.Variants, variant.Name)
+		}
+
+	default:
+		input.Type = "object"
+	}
+
+	return input
+}
+
+func newJSONInputs(i *idl.IDL, in *idl.Type) []jsonInput {
+	inputs := make([]jsonInput, 0, len(in.Fields))
+	for _, field := range in.Fields {
+		inputs = append(inputs, newJSONInput(i, field))
+	}
+
+	return inputs
+}
+
+// annotationMap returns the annotations of a member by name.
+func annotationMap(annotations []idl.Annotation) map[string]string {
+	if len(annotations) == 0 {
+		return nil
+	}
+
+	m := make(map[string]string, len(annotations))
+	for _, a := range annotations {
+		m[a.Name] = a.Value
+	}
+
+	return m
+}
+
+func newJSONMember(i *idl.IDL, member interface{}) jsonMember {
+	switch m := member.(type) {
+	case *idl.Alias:
+		return jsonMember{
+			Kind:        "type",
+			Name:        m.Name,
+			Doc:         m.Doc,
+			Type:        newJSONType(m.Type),
+			Annotations: annotationMap(m.Annotations),
+		}
+
+	case *idl.Method:
+		annotations := annotationMap(m.Annotations)
+		_, streaming := annotations["stream"]
+		return jsonMember{
+			Kind:        "method",
+			Name:        m.Name,
+			Doc:         m.Doc,
+			In:          newJSONType(m.In),
+			Out:         newJSONType(m.Out),
+			Inputs:      newJSONInputs(i, m.In),
+			Annotations: annotations,
+			Streaming:   streaming,
+		}
+
+	case *idl.Error:
+		return jsonMember{
+			Kind:        "error",
+			Name:        m.Name,
+			Doc:         m.Doc,
+			Type:        newJSONType(m.Type),
+			Annotations: annotationMap(m.Annotations),
+		}
+	}
+
+	return jsonMember{}
+}
+
+func newJSONInterface(i *idl.IDL) *jsonInterface {
+	j := &jsonInterface{
+		Name:    i.Name,
+		Doc:     i.Doc,
+		Members: make([]jsonMember, 0, len(i.Members)),
+	}
+	for _, member := range i.Members {
+		j.Members = append(j.Members, newJSONMember(i, member))
+	}
+
+	return j
+}
+
+// interfaceMembers returns the members of the given kind ("type", "method"
+// or "error") in declaration order.
+func interfaceMembers(i *idl.IDL, kind string) []jsonMember {
+	members := make([]jsonMember, 0)
+	for _, member := range i.Members {
+		if m := newJSONMember(i, member); m.Kind == kind {
+			members = append(members, m)
+		}
+	}
+
+	return members
+}
+
+// interfaceMember returns the member of the given kind and name, or nil if
+// it does not exist.
+func interfaceMember(i *idl.IDL, kind string, name string) *jsonMember {
+	for _, m := range interfaceMembers(i, kind) {
+		if m.Name == name {
+			return &m
+		}
+	}
+
+	return nil
+}
+
+// serveParse parses the interface description in the request body and
+// returns its JSON representation. Documents with more than one interface
+// are returned as an array.
+func serveParse(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		httpError(writer, request, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	description, err := io.ReadAll(http.MaxBytesReader(writer, request.Body, maxDescriptionSize))
+	if err != nil {
+		bodyError(writer, request, err)
+		return
+	}
+
+	idls, err := idl.NewInterfaces(string(description))
+	if err != nil {
+		varlinkError(writer, request, &varlink.Error{
+			Name:       "org.varlink.http.InvalidInterfaceDescription",
+			Parameters: map[string]string{"message": err.Error()},
+		}, http.StatusBadRequest)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if len(idls) == 1 {
+		newEncoder(writer, request).Encode(newJSONInterface(idls[0]))
+		return
+	}
+
+	out := make([]*jsonInterface, 0, len(idls))
+	for _, i := range idls {
+		out = append(out, newJSONInterface(i))
+	}
+	newEncoder(writer, request).Encode(out)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testDocument = `# The first interface.
+interface org.example.first
+
+type Item (name: string, tags: []string)
+
+method Get(name: string) -> (item: Item)
+
+error NotFound (name: string)
+
+# The second interface.
+interface org.example.second
+
+method Ping(ping: string) -> (pong: string)
+`
+
+// parse posts description to /parse and returns the response.
+func parse(description string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/parse", strings.NewReader(description))
+	recorder := httptest.NewRecorder()
+	serveParse(recorder, request)
+
+	return recorder
+}
+
+func TestParseMultipleInterfaces(t *testing.T) {
+	recorder := parse(testDocument)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", recorder.Code, recorder.Body)
+	}
+
+	var out []jsonInterface
+	if err := json.Unmarshal(recorder.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 2 || out[0].Name != "org.example.first" || out[1].Name != "org.example.second" {
+		t.Errorf("got %s, expected org.example.first and org.example.second", recorder.Body)
+	}
+}
+
+func TestParseTruncated(t *testing.T) {
+	for n := 0; n < len(testDocument); n++ {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("prefix of %d bytes: panic: %v", n, r)
+				}
+			}()
+
+			recorder := parse(testDocument[:n])
+			if recorder.Code != http.StatusOK && recorder.Code != http.StatusBadRequest {
+				t.Errorf("prefix of %d bytes: got status %d: %s", n, recorder.Code, recorder.Body)
+			}
+		}()
+	}
+}
+
+// unorderedDescription declares members and fields in neither alphabetical
+// nor grouped order.
+const unorderedDescription = `interface org.example.test
+
+error Zeta (z: string, a: int)
+
+method Omega(zebra: int, apple: string, mango: bool) -> (z: int, a: int)
+
+type Beta (y: string, b: (d: int, c: int))
+
+method Alpha() -> ()
+
+error Failed (reason: string)
+
+type Item (name: string, count: int)
+`
+
+// memberNames returns "kind name" of every member, and the names of the
+// fields of their types.
+func memberNames(members []jsonMember) []string {
+	var fields func(t *jsonType) string
+	fields = func(t *jsonType) string {
+		if t == nil || (t.Kind != "struct" && t.Kind != "enum") {
+			return ""
+		}
+		names := make([]string, 0, len(t.Fields))
+		for _, field := range t.Fields {
+			names = append(names, field.Name+fields(field.Type))
+		}
+		return "(" + strings.Join(names, ", ") + ")"
+	}
+
+	names := make([]string, 0, len(members))
+	for _, m := range members {
+		names = append(names, m.Kind+" "+m.Name+fields(m.Type)+fields(m.In)+fields(m.Out))
+	}
+
+	return names
+}
+
+func TestParseKeepsDeclarationOrder(t *testing.T) {
+	recorder := parse(unorderedDescription)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", recorder.Code, recorder.Body)
+	}
+
+	var out jsonInterface
+	if err := json.Unmarshal(recorder.Body.Bytes(), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"error Zeta(z, a)",
+		"method Omega(zebra, apple, mango)(z, a)",
+		"type Beta(y, b(d, c))",
+		"method Alpha()()",
+		"error Failed(reason)",
+		"type Item(name, count)",
+	}
+	if names := memberNames(out.Members); !reflect.DeepEqual(names, expected) {
+		t.Errorf("got members %q, expected %q", names, expected)
+	}
+}
+
+func TestInterfaceMembersKeepDeclarationOrder(t *testing.T) {
+	iface := newTestInterface()
+	iface.description = unorderedDescription
+	startTestService(t, iface)
+	server := startProxy(t)
+
+	for kind, expected := range map[string][]string{
+		"methods": {"method Omega(zebra, apple, mango)(z, a)", "method Alpha()()"},
+		"errors":  {"error Zeta(z, a)", "error Failed(reason)"},
+		"types":   {"type Beta(y, b(d, c))", "type Item(name, count)"},
+	} {
+		response, body := get(t, server.URL+"/interface/org.example.test/"+kind)
+		checkStatus(t, response, body, http.StatusOK)
+
+		var members []jsonMember
+		if err := json.Unmarshal([]byte(body), &members); err != nil {
+			t.Fatal(err)
+		}
+		if names := memberNames(members); !reflect.DeepEqual(names, expected) {
+			t.Errorf("%s: got %q, expected %q", kind, names, expected)
+		}
+	}
+
+	// the example parameters and the inputs of the form follow the fields
+	response, body := get(t, server.URL+"/interface/org.example.test/methods")
+	checkStatus(t, response, body, http.StatusOK)
+	if !strings.Contains(body, `"inputs":[{"name":"zebra"`) || strings.Index(body, `"name":"apple"`) > strings.Index(body, `"name":"mango"`) {
+		t.Errorf("inputs not in declaration order: %s", body)
+	}
+	if got := defaultJSON(t, unorderedDescription); got != `{"zebra":0,"apple":"","mango":false}` {
+		t.Errorf("got default value %s, expected the fields in declaration order", got)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// trimTrailingComma removes a comma which is only followed by whitespace.
+func trimTrailingComma(b []byte) []byte {
+	i := len(b) - 1
+	for i >= 0 && (b[i] == ' ' || b[i] == '\t' || b[i] == '\r' || b[i] == '\n') {
+		i--
+	}
+	if i >= 0 && b[i] == ',' {
+		return append(b[:i], b[i+1:]...)
+	}
+
+	return b
+}
+
+// lenientJSON removes // and /* */ comments and trailing commas in objects
+// and arrays from a hand-written JSON document. String values are copied
+// unchanged.
+func lenientJSON(in []byte) []byte {
+	out := make([]byte, 0, len(in))
+	inString := false
+
+	for i := 0; i < len(in); i++ {
+		c := in[i]
+
+		if inString {
+			out = append(out, c)
+			if c == '\\' && i+1 < len(in) {
+				i++
+				out = append(out, in[i])
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+
+		switch {
+		case c == '"':
+			inString = true
+			out = append(out, c)
+
+		case c == '/' && i+1 < len(in) && in[i+1] == '/':
+			end := bytes.IndexByte(in[i:], '\n')
+			if end < 0 {
+				i = len(in)
+			} else {
+				// keep the newline
+				i += end - 1
+			}
+
+		case c == '/' && i+1 < len(in) && in[i+1] == '*':
+			end := bytes.Index(in[i+2:], []byte("*/"))
+			if end < 0 {
+				i = len(in)
+			} else {
+				i += 2 + end + 1
+			}
+			// keep tokens around the comment apart
+			out = append(out, ' ')
+
+		case c == '}' || c == ']':
+			out = append(trimTrailingComma(out), c)
+
+		default:
+			out = append(out, c)
+		}
+	}
+
+	return out
+}
+
+// decodeBody decodes the JSON request body into v. With ?lenient=true, the
+// body may contain comments and trailing commas. An empty body returns
+// io.EOF.
+func decodeBody(request *http.Request, v interface{}) error {
+	var body io.Reader = request.Body
+	if request.URL.Query().Get("lenient") == "true" {
+		b, err := io.ReadAll(request.Body)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(lenientJSON(b))
+	}
+
+	// Keep numbers as they were sent, integers above 2^53 would lose
+	// precision as float64.
+	decoder := json.NewDecoder(body)
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestLenientJSON(t *testing.T) {
+	for _, test := range []struct {
+		in       string
+		expected string
+	}{
+		{`{"a": 1}`, `{"a": 1}`},
+		{"{\"a\": 1, // comment\n}", "{\"a\": 1 \n}"},
+		{`{"a": 1, /* comment */}`, `{"a": 1  }`},
+		{`[1, 2, 3,]`, `[1, 2, 3]`},
+		{`{"a": "// not a comment", "b": "/* nor this */"}`, `{"a": "// not a comment", "b": "/* nor this */"}`},
+		{`{"a": "\" // still a string"}`, `{"a": "\" // still a string"}`},
+		{`[1/* c */2]`, `[1 2]`},
+	} {
+		if out := string(lenientJSON([]byte(test.in))); out != test.expected {
+			t.Errorf("%q: got %q, expected %q", test.in, out, test.expected)
+		}
+	}
+}
+
+func TestLenientJSONDoesNotJoinTokens(t *testing.T) {
+	// the comment separates two values, which is invalid
+	var v interface{}
+	if err := json.Unmarshal(lenientJSON([]byte(`{"a": 1/* c */2}`)), &v); err == nil {
+		t.Errorf("got %v, expected a syntax error", v)
+	}
+}
+
+func TestLenientCall(t *testing.T) {
+	startTestService(t)
+	server := startProxy(t)
+
+	response, body := post(t, server.URL+"/?lenient=true", `{
+		// a comment
+		"method": "org.example.test.Echo",
+		"parameters": {
+			"text": "a /* string */ // value",
+			"number": /* block */ 12,
+		},
+	}`)
+	checkStatus(t, response, body, http.StatusOK)
+
+	if expected := `{"parameters":{"number":12,"text":"a /* string */ // value"}}` + "\n"; body != expected {
+		t.Errorf("got %q, expected %q", body, expected)
+	}
+}
+
+func TestCallLargeIntegers(t *testing.T) {
+	startTestService(t)
+	server := startProxy(t)
+
+	// 2^53 + 1 and the largest int64 are not representable as float64
+	for _, number := range []string{"9007199254740993", "9223372036854775807", "-9223372036854775808"} {
+		parameters := `{"text": "large", "number": ` + number + `}`
+		expected := `"number":` + number + `,`
+
+		for _, test := range []struct{ path, body string }{
+			{"/", `{"method": "org.example.test.Echo", "parameters": ` + parameters + `}`},
+			{"/?lenient=true", `{"method": "org.example.test.Echo", "parameters": ` + parameters + `, /* lenient */}`},
+			{"/?collect=true", `{"method": "org.example.test.Echo", "parameters": ` + parameters + `}`},
+			{"/call/org.example.test.Echo", parameters},
+		} {
+			response, body := post(t, server.URL+test.path, test.body)
+			checkStatus(t, response, body, http.StatusOK)
+			if !strings.Contains(body, expected) {
+				t.Errorf("%s: got %s, expected %s", test.path, body, expected)
+			}
+		}
+
+		if body := postForm(t, server.URL, "Echo", parameters); !strings.Contains(body, `"number": `+number+`,`) {
+			t.Errorf("method form: got %s, expected %s", body, number)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"sync"
+	"time"
+)
+
+var maxInterfaceCalls = flag.Int("max-interface-calls", 0, "maximum `number` of concurrent calls per interface (0 is unlimited)")
+var callQueueTimeout = flag.Duration("call-queue-timeout", 0, "wait up to `duration` for a call slot before rejecting a call")
+
+// interfaceLimiter limits the number of concurrent calls per interface with
+// one semaphore per interface. A semaphore is removed when no call holds or
+// waits for one of its slots.
+type interfaceLimiter struct {
+	mutex      sync.Mutex
+	semaphores map[string]*semaphore
+}
+
+type semaphore struct {
+	slots chan struct{}
+
+	// users counts the calls holding or waiting for a slot
+	users int
+}
+
+var callLimiter = interfaceLimiter{semaphores: make(map[string]*semaphore)}
+
+// get returns the semaphore of iface, counting the caller as its user until
+// it calls put.
+func (l *interfaceLimiter) get(iface string) *semaphore {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	sem, ok := l.semaphores[iface]
+	if !ok {
+		sem = &semaphore{slots: make(chan struct{}, *maxInterfaceCalls)}
+		l.semaphores[iface] = sem
+	}
+	sem.users++
+
+	return sem
+}
+
+// put ends a use of the semaphore of iface started with get.
+func (l *interfaceLimiter) put(iface string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	sem := l.semaphores[iface]
+	sem.users--
+	if sem.users == 0 {
+		delete(l.semaphores, iface)
+	}
+}
+
+// acquire takes a call slot for iface, waiting up to the call queue timeout
+// for one to become free. It returns false if no slot could be taken.
+func (l *interfaceLimiter) acquire(iface string) bool {
+	if *maxInterfaceCalls <= 0 {
+		return true
+	}
+
+	sem := l.get(iface)
+	select {
+	case sem.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if *callQueueTimeout > 0 {
+		timer := time.NewTimer(*callQueueTimeout)
+		defer timer.Stop()
+
+		select {
+		case sem.slots <- struct{}{}:
+			return true
+		case <-timer.C:
+		}
+	}
+
+	l.put(iface)
+	return false
+}
+
+// release frees a call slot taken with acquire.
+func (l *interfaceLimiter) release(iface string) {
+	if *maxInterfaceCalls <= 0 {
+		return
+	}
+
+	l.mutex.Lock()
+	sem := l.semaphores[iface]
+	l.mutex.Unlock()
+
+	<-sem.slots
+	l.put(iface)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestInterfaceLimiterRemovesSemaphores(t *testing.T) {
+	setFlag(t, "max-interface-calls", "1")
+
+	if !callLimiter.acquire("org.example.test") {
+		t.Fatal("first call was not admitted")
+	}
+	if callLimiter.acquire("org.example.test") {
+		t.Error("second call was admitted")
+	}
+	if n := len(callLimiter.semaphores); n != 1 {
+		t.Errorf("got %d semaphores while a call is running, expected 1", n)
+	}
+
+	callLimiter.release("org.example.test")
+	if n := len(callLimiter.semaphores); n != 0 {
+		t.Errorf("got %d semaphores after the call, expected none", n)
+	}
+}
+
+func TestLimitersIgnoreInvalidInterfaces(t *testing.T) {
+	startTestService(t)
+	setFlag(t, "max-interface-calls", "1")
+	t.Setenv("RATE_LIMITS", "*=1/h")
+	t.Setenv("DENY_INTERFACES", "org.example.denied")
+	server := startProxy(t)
+
+	for _, method := range []string{"not an interface.Ping", "org..example.Ping", "org.example.denied.Ping"} {
+		response, body := post(t, server.URL+"/", `{"method": "`+method+`"}`)
+		if response.StatusCode != http.StatusBadRequest && response.StatusCode != http.StatusForbidden {
+			t.Errorf("%s: got status %d, expected 400 or 403: %s", method, response.StatusCode, body)
+		}
+	}
+
+	callRateLimiter.mutex.Lock()
+	n := len(callRateLimiter.buckets)
+	callRateLimiter.mutex.Unlock()
+	if n != 0 {
+		t.Errorf("got %d rate limit buckets, expected none", n)
+	}
+
+	callLimiter.mutex.Lock()
+	n = len(callLimiter.semaphores)
+	callLimiter.mutex.Unlock()
+	if n != 0 {
+		t.Errorf("got %d semaphores, expected none", n)
+	}
+}
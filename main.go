@@ -2,285 +2,1023 @@ package main
 
 import (
 	"encoding/json"
+	"expvar"
+	"flag"
 	"fmt"
-	"html/template"
 	"io"
 	"log"
+	"mime"
 	"net"
 	"net/http"
 	"os"
-	"path"
 	"strings"
+	"time"
 
 	"github.com/varlink/go/varlink"
 	"github.com/varlink/go/varlink/idl"
 )
 
 var datadir string = "static"
-var templates = template.Must(template.ParseGlob(path.Join(datadir, "*.html")))
 
-func connect(iface string) (*varlink.Connection, error) {
-	r, err := varlink.NewResolver("")
+var readHeaderTimeout = flag.Duration("read-header-timeout", 10*time.Second, "maximum `duration` for reading request headers")
+var readTimeout = flag.Duration("read-timeout", time.Minute, "maximum `duration` for reading a request")
+var writeTimeout = flag.Duration("write-timeout", 0, "maximum `duration` for writing a response (0 disables, streamed replies may take long)")
+var idleTimeout = flag.Duration("idle-timeout", 2*time.Minute, "close keep-alive connections after being idle for `duration`")
+var h2c = flag.Bool("h2c", false, "also serve HTTP/2 without TLS (h2c) to clients using it with prior knowledge")
+var requestTimeout = flag.Duration("request-timeout", 0, "reply with 504 to requests not handled within `duration` (0 disables)")
+var maxReplySize = flag.Int("max-reply-size", 64<<20, "maximum size of a reply from a service in `bytes` (0 disables)")
+var normalizeDescriptions = flag.Bool("normalize-descriptions", false, "serve .varlink descriptions in normalized format instead of as sent by the service")
+var trailingSlash = flag.Bool("trailing-slash", false, "use interface and method URLs with a trailing slash as canonical URLs")
+var docs = flag.Bool("docs", false, "serve interactive API documentation at /docs")
+var checkMethods = flag.Bool("check-methods", false, "reject calls to methods not declared in the interface description before calling them")
+
+// connect returns a connection to the service implementing iface, together
+// with the service address. If address is empty, iface is resolved,
+// otherwise address must match CALL_ADDRESSES and the service at address is
+// checked to implement iface.
+func connect(iface string, address string) (*varlink.Connection, string, error) {
+	if address != "" && !callAddresses.match(address) {
+		return nil, "", addressNotAllowed(address)
+	}
+
+	return connectAddress(iface, address)
+}
+
+// connectAddress is connect for addresses which were already checked
+// against an allow list, like the ones of followed calls.
+func connectAddress(iface string, address string) (*varlink.Connection, string, error) {
+	if err := checkInterfaceName(iface); err != nil {
+		return nil, "", err
+	}
+	if !interfaceAllowed(iface) {
+		return nil, "", interfaceNotAllowed(iface)
+	}
+
+	explicit := address != ""
+	if explicit {
+		if err := checkAddress(address); err != nil {
+			return nil, "", err
+		}
+	} else if iface == "org.varlink.resolver" {
+		// don't ask the resolver for itself
+		address = *resolverAddress
+	} else {
+		var err error
+		address, err = resolver.resolve(iface)
+		if err != nil {
+			return nil, "", err
+		}
+		if err := checkAddress(address); err != nil {
+			return nil, "", err
+		}
+	}
+
+	c, err := dial(address)
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+	c.SetMaxMessageSize(*maxReplySize)
+
+	if explicit {
+		if err := checkImplements(c, iface, address); err != nil {
+			closeConnection(c)
+			return nil, "", err
+		}
+	}
+
+	return c, address, nil
+}
+
+// checkAddress returns an error if address is not a valid address, or does
+// not use a supported transport.
+func checkAddress(address string) error {
+	words := strings.SplitN(address, ":", 2)
+	if len(words) != 2 || words[0] == "" || words[1] == "" {
+		return &varlink.Error{
+			Name:       "org.varlink.http.InvalidAddress",
+			Parameters: map[string]string{"address": address},
+		}
+	}
+
+	if words[0] != "unix" && words[0] != "tcp" {
+		return &varlink.Error{
+			Name:       "org.varlink.http.UnsupportedTransport",
+			Parameters: map[string]string{"transport": words[0], "address": address},
+		}
+	}
+
+	return nil
+}
+
+// checkInterfaceName returns an error if iface is not a valid interface
+// name, which no service could implement.
+func checkInterfaceName(iface string) error {
+	if !idl.ValidInterfaceName(iface) {
+		return &varlink.Error{
+			Name:       "org.varlink.http.InvalidInterface",
+			Parameters: map[string]string{"interface": iface},
+		}
+	}
+
+	return nil
+}
+
+// checkMethodName returns an error if method is not a method name qualified
+// by its interface name.
+func checkMethodName(method string) error {
+	dot := strings.LastIndex(method, ".")
+	if dot <= 0 || dot == len(method)-1 {
+		return &varlink.Error{
+			Name:       "org.varlink.http.InvalidMethod",
+			Parameters: map[string]string{"method": method},
+		}
 	}
-	defer r.Close()
 
-	address, err := r.Resolve(iface)
+	return nil
+}
+
+// checkImplements returns an error if the service connected with c does not
+// implement iface.
+func checkImplements(c *varlink.Connection, iface string, address string) error {
+	i, err := describeService(c, iface, address)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	if i.Name != iface {
+		return &varlink.Error{
+			Name:       "org.varlink.http.InterfaceMismatch",
+			Parameters: map[string]string{"interface": iface, "address": address},
+		}
+	}
+
+	return nil
+}
+
+// declaresMethod returns false if the description of iface is known and
+// does not declare method.
+func declaresMethod(iface string, method string) bool {
+	i, err := interfaces.describe(iface)
+	if err != nil {
+		// let the call itself report the error
+		return true
+	}
+
+	for _, m := range i.Methods {
+		if m.Name == method {
+			return true
+		}
 	}
 
-	return varlink.NewConnection(address)
+	return false
 }
 
-func jsonError(writer http.ResponseWriter, message string, code int) {
-	type Error struct{ Name string }
-	writer.WriteHeader(code)
+// callParameters returns the parameters to send for a method call. Missing
+// parameters are sent as an empty object, so methods without input
+// parameters can be called with and without a "parameters" field.
+func callParameters(parameters interface{}) interface{} {
+	if parameters == nil {
+		return struct{}{}
+	}
+
+	return parameters
+}
+
+// serveCallFrame writes the message which would be sent to the service for
+// a method call, without resolving the interface or calling the method. The
+// message is built the same way varlink.Connection.Send builds it.
+func serveCallFrame(writer http.ResponseWriter, request *http.Request, in methodCall, flags uint64) {
+	type call struct {
+		Method     string      `json:"method"`
+		Parameters interface{} `json:"parameters,omitempty"`
+		More       bool        `json:"more,omitempty"`
+		Oneway     bool        `json:"oneway,omitempty"`
+	}
+	type frame struct {
+		Frame string `json:"frame"`
+	}
+
+	b, err := json.Marshal(call{
+		Method:     in.Method,
+		Parameters: callParameters(in.Parameters),
+		More:       flags&varlink.More != 0,
+		Oneway:     flags&varlink.Oneway != 0,
+	})
+	if err != nil {
+		httpError(writer, request, err.Error(), http.StatusBadRequest)
+		return
+	}
+	b = append(b, 0)
+
 	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	newEncoder(writer, request).Encode(frame{string(b)})
+}
 
-	err := Error{"org.varlink.http"}
-	json.NewEncoder(writer).Encode(err)
+// newEncoder returns a JSON encoder for the reply to request. It indents its
+// output if the client asked for it with ?pretty=true.
+func newEncoder(writer io.Writer, request *http.Request) *json.Encoder {
+	encoder := json.NewEncoder(writer)
+	if request.URL.Query().Get("pretty") == "true" {
+		encoder.SetIndent("", "  ")
+	}
+
+	return encoder
 }
 
-func serveStaticFile(writer http.ResponseWriter, request *http.Request) {
-	switch request.Method {
-	case http.MethodGet:
-		// safe, because this function is only called for a few whitelisted file names
-		http.ServeFile(writer, request, path.Join(datadir, request.URL.Path))
+// wantsEventStream returns true if the client accepts method replies as
+// server-sent events.
+func wantsEventStream(request *http.Request) bool {
+	return negotiate(request, []string{"application/json", "text/event-stream"}) == "text/event-stream"
+}
 
-	default:
-		http.Error(writer, "Method not allowed on this URL", http.StatusMethodNotAllowed)
+func writeEvent(writer http.ResponseWriter, event string, data interface{}) {
+	if event != "" {
+		fmt.Fprintf(writer, "event: %s\n", event)
+	}
+
+	b, _ := json.Marshal(data)
+	fmt.Fprintf(writer, "data: %s\n\n", b)
+
+	if flusher, ok := writer.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// streamReplies writes all replies to a method call as server-sent events.
+// A failed call is reported as an "error" event.
+func streamReplies(writer http.ResponseWriter, receive func(interface{}) (uint64, error)) error {
+	type reply struct {
+		Parameters json.RawMessage `json:"parameters,omitempty"`
 	}
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+
+	for {
+		var out reply
+		flags, err := receive(&out.Parameters)
+		if err != nil {
+			body := errorBody{Error: statusError(errorStatus(err))}
+			if verr, ok := err.(*varlink.Error); ok {
+				body = errorBody{Error: verr.Name, Parameters: verr.Parameters}
+			}
+			body.Error = errorName(body.Error)
+			writeEvent(writer, "error", body)
+			return err
+		}
+
+		writeEvent(writer, "", out)
+
+		if flags&varlink.Continues == 0 {
+			return nil
+		}
+	}
+}
+
+// methodCall is a method call requested by a client. If Address is set, the
+// method is called on the service at that address instead of the one the
+// resolver returns.
+type methodCall struct {
+	Method     string
+	Parameters interface{}
+	More       *bool
+	Address    string
+
+	// followed is set if Address was taken from the reply of another call
+	// and already matched FOLLOW_ADDRESSES.
+	followed bool
+
+	// Follow is called on the service whose address is returned by
+	// Method, see followCall.
+	Follow *methodCall
+}
+
+// callRejection is the reason a call was not admitted, either an error of
+// the checks or a message of the limiters.
+type callRejection struct {
+	err        error
+	status     int
+	message    string
+	retryAfter string
+}
+
+// write writes the error reply for the rejection.
+func (r *callRejection) write(writer http.ResponseWriter, request *http.Request) {
+	if r.retryAfter != "" {
+		writer.Header().Set("Retry-After", r.retryAfter)
+	}
+	if r.err != nil {
+		callError(writer, request, r.err)
+		return
+	}
+
+	httpError(writer, request, r.message, r.status)
+}
+
+// admit checks whether method may be called now by the client of request
+// and takes a call slot of its interface, which must be released with
+// callLimiter.release. It returns the interface of method, or why the call
+// is not admitted.
+func admit(request *http.Request, method string) (string, *callRejection) {
+	if err := checkMethodName(method); err != nil {
+		return "", &callRejection{err: err}
+	}
+	parts := strings.Split(method, ".")
+	iface := strings.TrimSuffix(method, "."+parts[len(parts)-1])
+
+	// the limiters keep state per interface, only names of interfaces
+	// which may be called are admitted to them
+	if err := checkInterfaceName(iface); err != nil {
+		return "", &callRejection{err: err}
+	}
+	if !interfaceAllowed(iface) {
+		return "", &callRejection{err: interfaceNotAllowed(iface)}
+	}
+
+	if *checkMethods && !declaresMethod(iface, parts[len(parts)-1]) {
+		return "", &callRejection{err: &varlink.Error{
+			Name: "org.varlink.service.MethodNotFound",
+			Parameters: map[string]string{
+				"method":  method,
+				"message": "method " + parts[len(parts)-1] + " not declared by interface " + iface,
+			},
+		}}
+	}
+
+	if ok, wait := callRateLimiter.allow(iface, request.RemoteAddr); !ok {
+		return "", &callRejection{status: http.StatusTooManyRequests, message: "Rate limit exceeded", retryAfter: retryAfter(wait)}
+	}
+
+	if !callLimiter.acquire(iface) {
+		return "", &callRejection{status: http.StatusTooManyRequests, message: "Too many requests", retryAfter: "1"}
+	}
+
+	return iface, nil
+}
+
+// admitCall admits a call like admit. It returns the interface of method,
+// or writes the error reply and returns false if the call is not admitted.
+func admitCall(writer http.ResponseWriter, request *http.Request, method string) (string, bool) {
+	iface, rejection := admit(request, method)
+	if rejection != nil {
+		rejection.write(writer, request)
+		return "", false
+	}
+
+	return iface, true
+}
+
+// callMethod calls a varlink method with the given parameters and writes the
+// reply as JSON. If the client accepts server-sent events, every reply is
+// sent as a separate event instead.
+func callMethod(writer http.ResponseWriter, request *http.Request, call methodCall, flags uint64) {
+	method := call.Method
+	parameters := call.Parameters
+	if named := namedInterface(method, parameters); named != "" && !interfaceAllowed(named) {
+		varlinkError(writer, request, interfaceNotAllowed(named), http.StatusForbidden)
+		return
+	}
+
+	iface, ok := admitCall(writer, request, method)
+	if !ok {
+		return
+	}
+	defer callLimiter.release(iface)
+
+	var c *varlink.Connection
+	var address string
+	var s *session
+	var err error
+
+	// set when the call completed, so the connection can be reused
+	var completed bool
+
+	open := connect
+	if call.followed {
+		open = connectAddress
+	}
+
+	token := request.Header.Get(sessionHeader)
+	if token != "" {
+		s = sessions.lock(token)
+		if s == nil {
+			httpError(writer, request, "No such session", http.StatusNotFound)
+			return
+		}
+		defer s.mutex.Unlock()
+		c, address, err = s.connect(iface, call.Address, open)
+	} else {
+		c, address, err = open(iface, call.Address)
+		if err == nil {
+			defer func() {
+				pool.release(address, c, completed)
+			}()
+		}
+	}
+	if err != nil {
+		callErrorDebug(writer, request, err, callDebug{Method: method, Address: call.Address})
+		return
+	}
+
+	// Parameters are passed through as received, without decoding them
+	// into Go values.
+	type reply struct {
+		Method     string          `json:"method,omitempty"`
+		Address    string          `json:"address,omitempty"`
+		Parameters json.RawMessage `json:"parameters,omitempty"`
+		Continues  *bool           `json:"continues,omitempty"`
+	}
+	var out reply
+	envelope := request.URL.Query().Get("envelope") == "true"
+	if envelope {
+		out.Method = method
+		out.Address = address
+	}
+	stream := wantsEventStream(request)
+	collect := !stream && wantsCollect(request)
+	var replies []json.RawMessage
+	span := startChildSpan(request.Context(), method, spanKindClient)
+	span.setAttribute("rpc.system", "varlink")
+	span.setAttribute("rpc.service", iface)
+	span.setAttribute("rpc.method", strings.TrimPrefix(method, iface+"."))
+	span.setAttribute("server.address", address)
+	start := time.Now()
+	receive, err := c.Send(method, callParameters(parameters), flags)
+	if err == nil {
+		if stream {
+			err = streamReplies(writer, receive)
+			completed = true
+		} else if collect {
+			replies, err = collectReplies(c, receive)
+			completed = true
+		} else {
+			var replyFlags uint64
+			replyFlags, err = receive(&out.Parameters)
+			completed = replyFlags&varlink.Continues == 0
+			if envelope {
+				// only the first reply is returned, tell whether more
+				// were announced
+				continues := replyFlags&varlink.Continues != 0
+				out.Continues = &continues
+			}
+		}
+	}
+	logSlowCall(iface, method, start)
+	span.setError(err)
+	span.finish()
+	if verr, ok := err.(*varlink.Error); err != nil && (!ok || verr.Name == "org.varlink.http.TooManyReplies") {
+		// the connection is broken or replies are pending
+		completed = false
+	}
+	if !completed && s != nil {
+		// the next call of the session would receive the pending
+		// replies, it gets a new connection instead
+		s.drop(iface, call.Address)
+	}
+	if err != nil {
+		if stream {
+			return
+		}
+		callErrorDebug(writer, request, err, callDebug{
+			Method:  method,
+			Address: address,
+			Reply:   string(c.LastMessage()),
+		})
+		return
+	}
+	if stream {
+		return
+	}
+
+	var body interface{} = out
+	if collect {
+		body = replies
+	}
+
+	if wantsMsgpack(request) {
+		if err := writeMsgpack(writer, body); err != nil {
+			callError(writer, request, err)
+		}
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	newEncoder(writer, request).Encode(body)
 }
 
 func serveRoot(writer http.ResponseWriter, request *http.Request) {
 	if request.URL.Path != "/" {
-		http.Error(writer, "Not found", http.StatusNotFound)
+		httpError(writer, request, "Not found", http.StatusNotFound)
 		return
 	}
 
 	switch request.Method {
 	case http.MethodGet:
-		type info struct {
-			Vendor     string
-			Product    string
-			Version    string
-			URL        string
-			Interfaces []string
-		}
-		r, err := varlink.NewResolver(varlink.ResolverAddress)
-		if err != nil {
-			http.Error(writer, "Not found", http.StatusNotFound)
-			return
-		}
-		defer r.Close()
-
-		var i info
-		err = r.GetInfo(&i.Vendor, &i.Product, &i.Version, &i.URL, &i.Interfaces)
+		i, err := resolver.cachedInfo(request.URL.Query().Get("nocache") == "true")
 		if err != nil {
-			http.Error(writer, "Not found"+err.Error(), http.StatusNotFound)
+			callError(writer, request, err)
 			return
 		}
+		// allowedInterfaces returns a copy, the cached list stays as is
+		i.Interfaces = uniqueSorted(allowedInterfaces(i.Interfaces))
 
-		if strings.Contains(request.Header.Get("Accept"), "application/json") {
+		if negotiate(request, []string{"text/html", "application/json"}) == "application/json" {
 			writer.Header().Set("Content-Type", "application/json; charset=utf-8")
-			json.NewEncoder(writer).Encode(i)
+			newEncoder(writer, request).Encode(i)
 		} else {
 			writer.Header().Set("Content-Type", "text/html; charset=utf-8")
-			templates.ExecuteTemplate(writer, "index.html", i)
+			executeTemplate(writer, "index.html", i)
 		}
 
 	case http.MethodPost:
-		type call struct {
-			Method     string
-			Parameters interface{}
+		var in methodCall
+		var err error
+		if mediaType, _, _ := mime.ParseMediaType(request.Header.Get("Content-Type")); mediaType == "application/x-www-form-urlencoded" {
+			in.Method, in.Parameters, err = formCall(request)
+		} else if request.URL.Query().Get("raw") == "true" {
+			in, err = decodeRawCall(request)
+		} else {
+			err = decodeBody(request, &in)
+			if values, ok := in.Parameters.([]interface{}); err == nil && ok {
+				in.Parameters, err = positionalParameters(in, values)
+			}
+			if err == nil && request.URL.Query().Get("coerce") == "true" {
+				in.Parameters, err = coerceParameters(in)
+			}
 		}
-		var in call
-		err := json.NewDecoder(request.Body).Decode(&in)
 		if err != nil {
-			jsonError(writer, err.Error(), http.StatusBadRequest)
+			if verr, ok := err.(*varlink.Error); ok {
+				varlinkError(writer, request, verr, errorStatus(err))
+				return
+			}
+			bodyError(writer, request, err)
 			return
 		}
 
-		parts := strings.Split(in.Method, ".")
-		iface := strings.TrimSuffix(in.Method, "."+parts[len(parts)-1])
+		// Clients accepting server-sent events or collecting the
+		// replies get all of them, unless they explicitly ask for a
+		// single one with "more": false.
+		more := wantsEventStream(request) || wantsCollect(request)
+		if in.More != nil {
+			more = *in.More
+		}
 
-		c, err := connect(iface)
-		if err != nil {
-			if verr, ok := err.(*varlink.Error); ok {
-				if verr.Name == "org.varlink.resolver.InterfaceNotFound" {
-					writer.WriteHeader(http.StatusNotFound)
-					writer.Header().Set("Content-Type", "application/json; charset=utf-8")
-					json.NewEncoder(writer).Encode(verr)
-					return
-				}
-			}
-			jsonError(writer, "Internal server error", http.StatusInternalServerError)
-			return
+		var flags uint64
+		if more {
+			flags |= varlink.More
 		}
-		defer c.Close()
 
-		type reply struct {
-			Parameters interface{} `json:"parameters,omitempty"`
+		if request.URL.Query().Get("dryrun") == "true" {
+			serveCallFrame(writer, request, in, flags)
+			return
 		}
-		var out reply
-		err = c.Call(in.Method, in.Parameters, &out.Parameters)
-		if err != nil {
-			jsonError(writer, "Internal server error", http.StatusInternalServerError)
+
+		if path := request.URL.Query().Get("follow"); path != "" {
+			followCall(writer, request, in, path, flags)
 			return
 		}
 
-		writer.Header().Set("Content-Type", "application/json; charset=utf-8")
-		json.NewEncoder(writer).Encode(out)
+		callMethod(writer, request, in, flags)
 
-	default:
-		if strings.Contains(request.Header.Get("Accept"), "application/json") {
-			jsonError(writer, "Bad request", http.StatusBadRequest)
-			return
-		} else {
-			http.Error(writer, "Bad request", http.StatusBadRequest)
+	case http.MethodDelete:
+		token := request.Header.Get(sessionHeader)
+		if token == "" {
+			httpError(writer, request, "Missing "+sessionHeader+" header", http.StatusBadRequest)
 			return
 		}
+		sessions.end(token)
+		writer.WriteHeader(http.StatusNoContent)
+
+	default:
+		httpError(writer, request, "Bad request", http.StatusBadRequest)
 	}
 }
 
-func defaultValue(i *idl.IDL, t *idl.Type) interface{} {
-	switch t.Kind {
-	case idl.TypeBool:
-		return false
+// serveCall calls the method named by the URL path, taking the method
+// parameters as the request body. This allows each method to be addressed
+// by its own URL, as described by the generated OpenAPI documents.
+func serveCall(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		httpError(writer, request, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
 
-	case idl.TypeInt:
-		return 0
+	method := request.URL.Path[len("/call/"):]
+	if method == "" {
+		httpError(writer, request, "Not found", http.StatusNotFound)
+		return
+	}
 
-	case idl.TypeFloat:
-		return 0.0
+	var parameters interface{}
+	err := decodeBody(request, &parameters)
+	if err != nil && err != io.EOF {
+		bodyError(writer, request, err)
+		return
+	}
 
-	case idl.TypeString:
-		return ""
+	call := methodCall{Method: method, Parameters: parameters}
+	if request.URL.Query().Get("coerce") == "true" {
+		call.Parameters, err = coerceParameters(call)
+		if err != nil {
+			callError(writer, request, err)
+			return
+		}
+	}
 
-	case idl.TypeArray:
-		return make([]interface{}, 0)
+	var flags uint64
+	if wantsEventStream(request) {
+		flags |= varlink.More
+	}
 
-	case idl.TypeStruct:
-		v := make(map[string]interface{})
-		for _, field := range t.Fields {
-			v[field.Name] = defaultValue(i, field.Type)
-		}
-		return v
+	callMethod(writer, request, call, flags)
+}
+
+// errorExample is an error of an interface with an example of its
+// parameters, which is empty for errors without parameters.
+type errorExample struct {
+	Name       string
+	Doc        string
+	Parameters string
+}
 
-	case idl.TypeAlias:
-		for _, alias := range i.Aliases {
-			if alias.Name == t.Alias {
-				return defaultValue(i, alias.Type)
+// errorExamples returns examples of the replies of all errors of i.
+func errorExamples(i *idl.IDL) []errorExample {
+	examples := make([]errorExample, 0, len(i.Errors))
+	for _, e := range i.Errors {
+		example := errorExample{Name: e.Name, Doc: e.Doc}
+		if e.Type != nil && (e.Type.Kind != idl.TypeStruct || len(e.Type.Fields) > 0) {
+			value, err := json.MarshalIndent(defaultValue(i, e.Type), "", "  ")
+			if err == nil {
+				example.Parameters = string(value)
 			}
 		}
-		return nil
+		examples = append(examples, example)
 	}
 
-	return nil
+	return examples
+}
+
+// canonicalInterfacePath returns the canonical form of an /interface/ URL
+// path, with or without trailing slash according to -trailing-slash. Paths
+// of documents like .varlink files never end in a slash.
+func canonicalInterfacePath(p string) string {
+	if p == "/interface/" {
+		return p
+	}
+
+	p = strings.TrimSuffix(p, "/")
+	if *trailingSlash && !strings.HasSuffix(p, ".varlink") && !strings.HasSuffix(p, ".json") {
+		p += "/"
+	}
+
+	return p
 }
 
 func serveInterface(writer http.ResponseWriter, request *http.Request) {
-	if request.Method != http.MethodGet {
-		http.Error(writer, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+	if request.Method == http.MethodGet || request.Method == http.MethodHead {
+		if canonical := canonicalInterfacePath(request.URL.Path); canonical != request.URL.Path {
+			u := *request.URL
+			u.Path = *basePath + canonical
+			u.RawPath = ""
+			http.Redirect(writer, request, u.String(), http.StatusMovedPermanently)
+			return
+		}
 	}
 
 	path := strings.TrimSuffix(request.URL.Path[len("/interface/"):], "/")
 	parts := strings.Split(path, "/")
 	name := strings.TrimSuffix(parts[0], ".varlink")
 
-	c, err := connect(name)
-	if err != nil {
-		if verr, ok := err.(*varlink.Error); ok {
-			if verr.Name == "org.varlink.resolver.InterfaceNotFound" {
-				http.Error(writer, "Interface does not exist: "+parts[0], http.StatusNotFound)
-				return
-			}
+	switch request.Method {
+	case http.MethodGet, http.MethodHead:
+		break
+
+	case http.MethodPost:
+		// only the method form posts back to itself, and smoke tests
+		// call methods
+		if !(len(parts) == 3 && parts[1] == "call") && !(len(parts) == 2 && parts[1] == "smoketest") {
+			httpError(writer, request, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+	case http.MethodDelete:
+		// evict the cached description, the next request refetches it
+		if len(parts) != 1 {
+			httpError(writer, request, "Method not allowed", http.StatusMethodNotAllowed)
+			return
 		}
-		http.Error(writer, "Internal server error", http.StatusInternalServerError)
-		log.Print(err.Error())
+		interfaces.invalidate(name)
+		writer.WriteHeader(http.StatusNoContent)
+		return
+
+	default:
+		httpError(writer, request, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	defer c.Close()
 
-	desc, err := c.GetInterfaceDescription(name)
-	if err != nil {
-		http.Error(writer, "Internal server error", http.StatusInternalServerError)
-		log.Print(err.Error())
+	if len(parts) == 2 && parts[1] == "smoketest" && !*smokeTests {
+		// checked before the description is fetched from the service
+		httpError(writer, request, "Not found", http.StatusNotFound)
 		return
 	}
 
-	i, err := idl.New(desc)
+	var i *idl.IDL
+	var err error
+	if address := request.URL.Query().Get("address"); address != "" {
+		i, err = fetchDescription(name, address)
+	} else {
+		i, err = interfaces.describe(name)
+	}
 	if err != nil {
-		http.Error(writer, "Internal server error", http.StatusInternalServerError)
-		log.Print(err.Error())
+		callError(writer, request, err)
 		return
 	}
 
 	switch len(parts) {
 	case 1:
 		if strings.HasSuffix(parts[0], ".varlink") {
-			writer.Header().Set("Content-Type", "text/plain")
-			io.WriteString(writer, i.Description)
+			description := i.Description
+			if request.URL.Query().Get("format") == "canonical" {
+				description = i.Canonical()
+			} else if *normalizeDescriptions {
+				description = i.String()
+			}
+			writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			if request.URL.Query().Get("download") == "true" {
+				writer.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".varlink"}))
+			}
+			// handles Range requests, and sets Content-Length
+			http.ServeContent(writer, request, name+".varlink", time.Time{}, strings.NewReader(description))
 		} else {
-			templates.ExecuteTemplate(writer, "interface.html", i)
+			writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+			executeTemplate(writer, "interface.html", struct {
+				*idl.IDL
+				ErrorExamples []errorExample
+			}{i, errorExamples(i)})
 		}
 	case 2:
-		var method *idl.Method
-
-		for _, m := range i.Methods {
-			if m.Name == parts[1] {
-				method = m
-				break
+		switch parts[1] {
+		case "openapi.json":
+			document, err := openAPI(baseURL(request), i)
+			if err != nil {
+				callError(writer, request, err)
+				return
 			}
+			writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+			newEncoder(writer, request).Encode(document)
+			return
+
+		case "smoketest":
+			serveSmokeTest(writer, request, i)
+			return
+
+		case "methods", "errors", "types":
+			writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+			newEncoder(writer, request).Encode(interfaceMembers(i, strings.TrimSuffix(parts[1], "s")))
+			return
 		}
+
+		method := methodByName(i, parts[1])
 		if method == nil {
-			http.Error(writer, "Method does not exist: "+parts[1], http.StatusNotFound)
+			httpError(writer, request, "Method does not exist: "+parts[1], http.StatusNotFound)
 			return
 		}
 
 		value, err := json.MarshalIndent(defaultValue(i, method.In), "", "  ")
 		if err != nil {
-			http.Error(writer, "Internal server error", http.StatusInternalServerError)
+			httpError(writer, request, "Internal server error", http.StatusInternalServerError)
 			log.Print(err.Error())
 			return
 		}
 
-		templates.ExecuteTemplate(writer, "method.html", map[string]interface{}{
+		writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+		executeTemplate(writer, "method.html", map[string]interface{}{
 			"Interface":     i,
 			"Method":        method,
 			"DefaultInArgs": string(value),
+			"ErrorExamples": errorExamples(i),
 		})
+	case 3:
+		if parts[1] == "call" {
+			serveMethodForm(writer, request, i, parts[2])
+			return
+		}
+
+		if parts[1] != "method" && parts[1] != "error" && parts[1] != "type" {
+			httpError(writer, request, "Not found", http.StatusNotFound)
+			return
+		}
+
+		member := interfaceMember(i, parts[1], parts[2])
+		if member == nil {
+			httpError(writer, request, "Member does not exist: "+parts[2], http.StatusNotFound)
+			return
+		}
+
+		writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+		newEncoder(writer, request).Encode(member)
 	default:
-		http.Error(writer, "Bad Request", http.StatusBadRequest)
+		httpError(writer, request, "Bad Request", http.StatusBadRequest)
 		return
 	}
 }
 
+// checkListenAddress returns a descriptive error if address is not of the
+// form HOST:PORT.
+func checkListenAddress(address string) error {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		if strings.Count(address, ":") > 1 && !strings.HasPrefix(address, "[") {
+			return fmt.Errorf("IPv6 addresses must be enclosed in brackets, like [::1]:8080")
+		}
+		if !strings.Contains(address, ":") {
+			return fmt.Errorf("missing port, use :%s to listen on all addresses", address)
+		}
+		return err
+	}
+
+	if port == "" {
+		return fmt.Errorf("missing port")
+	}
+
+	return nil
+}
+
+// newHandler returns the handler serving all URLs, wrapped in the
+// middleware enabled by the flags and environment settings.
+func newHandler() (http.Handler, error) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/favicon.ico", serveStaticFile)
+	mux.HandleFunc("/varlink.css", serveStaticFile)
+	mux.Handle("/index.html", http.RedirectHandler(*basePath+"/", http.StatusMovedPermanently))
+
+	mux.HandleFunc("/interface/", serveInterface)
+	mux.HandleFunc("/call/", serveCall)
+	mux.HandleFunc("/openapi.json", serveOpenAPI)
+	mux.HandleFunc("/parse", serveParse)
+	mux.HandleFunc("/diff", serveDiff)
+	mux.HandleFunc("/version", serveVersion)
+	mux.HandleFunc("/search", serveSearch)
+	mux.HandleFunc("/resolve/", serveResolve)
+	mux.HandleFunc("/healthz", serveHealth)
+	mux.HandleFunc("/session", serveSession)
+	mux.HandleFunc("/session/", serveSession)
+	if *docs {
+		mux.HandleFunc("/docs", serveDocs)
+		mux.HandleFunc("/docs.js", serveStaticFile)
+	}
+	if *serveConfig {
+		if os.Getenv("AUTH_TOKEN") == "" {
+			return nil, fmt.Errorf("-serve-config requires AUTH_TOKEN")
+		}
+		mux.HandleFunc("/config", serveConfiguration)
+	}
+	if *debugVars {
+		if os.Getenv("AUTH_TOKEN") == "" {
+			return nil, fmt.Errorf("-debug-vars requires AUTH_TOKEN")
+		}
+		mux.Handle("/debug/vars", expvar.Handler())
+	}
+	mux.HandleFunc("/", serveRoot)
+
+	interfaceAccess.allow = parseInterfacePatterns(os.Getenv("ALLOW_INTERFACES"))
+	interfaceAccess.deny = parseInterfacePatterns(os.Getenv("DENY_INTERFACES"))
+	followAddresses = parseAddressPatterns(os.Getenv("FOLLOW_ADDRESSES"))
+	callAddresses = parseAddressPatterns(os.Getenv("CALL_ADDRESSES"))
+
+	limits, err := parseRateLimits(os.Getenv("RATE_LIMITS"))
+	if err != nil {
+		return nil, err
+	}
+	callRateLimiter.limits = limits
+
+	var handler http.Handler = withRequestBody(mux)
+	if *basePath != "" {
+		handler = withBasePath(handler)
+	}
+	if *requestTimeout > 0 {
+		handler = withTimeout(*requestTimeout, handler)
+	}
+	if token := os.Getenv("AUTH_TOKEN"); token != "" {
+		handler = requireToken(token, *publicIntrospection, handler)
+	}
+	if *accessLog {
+		handler = withAccessLog(handler)
+	}
+	if err := startTracing(); err != nil {
+		return nil, err
+	}
+	if tracingExporter != nil {
+		handler = withTracing(tracingExporter, handler)
+	}
+	if proxies := os.Getenv("TRUSTED_PROXIES"); proxies != "" {
+		trustedProxies, err = parseTrustedProxies(proxies)
+		if err != nil {
+			return nil, err
+		}
+		handler = withForwarded(handler)
+	}
+
+	return handler, nil
+}
+
 func main() {
-	http.HandleFunc("/favicon.ico", serveStaticFile)
-	http.HandleFunc("/varlink.css", serveStaticFile)
-	http.Handle("/index.html", http.RedirectHandler("/", http.StatusMovedPermanently))
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [OPTIONS] ADDRESS:PORT\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "The address can also be given in the LISTEN_ADDRESS environment variable.\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := setFlagsFromEnvironment(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
 
-	http.HandleFunc("/interface/", serveInterface)
-	http.HandleFunc("/", serveRoot)
+	if err := checkBasePath(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+
+	if !idl.ValidInterfaceName(*serviceName) {
+		fmt.Fprintf(os.Stderr, "invalid service name %q\n", *serviceName)
+		os.Exit(1)
+	}
+
+	if *printVersion {
+		b := getBuildInfo()
+		fmt.Printf("%s %s (commit %s, %s)\n", os.Args[0], b.Version, b.Commit, b.GoVersion)
+		return
+	}
+
+	if err := loadTemplates(); err != nil {
+		fmt.Fprintf(os.Stderr, "loading templates: %s\n", err)
+		os.Exit(1)
+	}
+	reloadTemplatesOnHangup()
+	if *maxConnections > 0 {
+		connectionSlots = make(chan struct{}, *maxConnections)
+	}
+	interfaces.sweepPeriodically()
+	pool.sweepPeriodically()
+
+	handler, err := newHandler()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+	callRateLimiter.sweepPeriodically()
+
+	logConfiguration()
+
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: *readHeaderTimeout,
+		ReadTimeout:       *readTimeout,
+		WriteTimeout:      *writeTimeout,
+		IdleTimeout:       *idleTimeout,
+	}
+	if *h2c {
+		// server-sent events are flushed as HTTP/2 data frames
+		server.Protocols = new(http.Protocols)
+		server.Protocols.SetHTTP1(true)
+		server.Protocols.SetUnencryptedHTTP2(true)
+	}
 
 	if _, ok := os.LookupEnv("LISTEN_FDS"); ok {
-		f := os.NewFile(3, "listen-fd")
-		listener, err := net.FileListener(f)
+		listeners, err := activationListeners(*listenFdName)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "invalid listen fd: "+err.Error())
+			fmt.Fprintf(os.Stderr, "socket activation: %s\n", err)
+			os.Exit(1)
 		}
 
-		http.Serve(listener, nil)
+		errs := make(chan error, len(listeners))
+		for _, listener := range listeners {
+			go func(listener net.Listener) {
+				errs <- server.Serve(listener)
+			}(listener)
+		}
+
+		fmt.Fprintf(os.Stderr, "%s\n", <-errs)
+		os.Exit(1)
 	} else {
-		if len(os.Args) != 2 {
-			fmt.Fprintf(os.Stderr, "usage: %s ADDRESS:PORT\n", os.Args[0])
+		address := os.Getenv("LISTEN_ADDRESS")
+		if flag.NArg() == 1 {
+			address = flag.Arg(0)
+		}
+		if flag.NArg() > 1 || address == "" {
+			flag.Usage()
+			os.Exit(1)
+		}
+		if err := checkListenAddress(address); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid listen address %q: %s\n", address, err)
 			os.Exit(1)
 		}
 
-		http.ListenAndServe(os.Args[1], nil)
+		server.Addr = address
+		if err := server.ListenAndServe(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
 	}
 }
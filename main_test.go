@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/varlink/go/varlink"
+)
+
+func TestCall(t *testing.T) {
+	startTestService(t)
+	server := startProxy(t)
+
+	response, body := post(t, server.URL+"/", `{"method": "org.example.test.Echo", "parameters": {"text": "hello", "number": 42}}`)
+	checkStatus(t, response, body, http.StatusOK)
+
+	expected := `{"parameters":{"number":42,"text":"hello"}}` + "\n"
+	if body != expected {
+		t.Errorf("got %q, expected %q", body, expected)
+	}
+}
+
+func TestCallPath(t *testing.T) {
+	startTestService(t)
+	server := startProxy(t)
+
+	response, body := post(t, server.URL+"/call/org.example.test.Echo", `{"text": "hello", "number": 42}`)
+	checkStatus(t, response, body, http.StatusOK)
+
+	expected := `{"parameters":{"number":42,"text":"hello"}}` + "\n"
+	if body != expected {
+		t.Errorf("got %q, expected %q", body, expected)
+	}
+}
+
+func TestCallError(t *testing.T) {
+	startTestService(t)
+	server := startProxy(t)
+
+	response, body := post(t, server.URL+"/", `{"method": "org.example.test.Fail"}`)
+	checkStatus(t, response, body, http.StatusBadRequest)
+
+	var reply errorBody
+	if err := json.Unmarshal([]byte(body), &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Error != "org.example.test.Failed" {
+		t.Errorf("got error %q, expected org.example.test.Failed", reply.Error)
+	}
+}
+
+func TestCallUnknownInterface(t *testing.T) {
+	startTestService(t)
+	server := startProxy(t)
+
+	response, body := post(t, server.URL+"/", `{"method": "org.example.unknown.Foo"}`)
+	checkStatus(t, response, body, http.StatusNotFound)
+
+	if !strings.Contains(body, "org.varlink.resolver.InterfaceNotFound") {
+		t.Errorf("got %s, expected org.varlink.resolver.InterfaceNotFound", body)
+	}
+}
+
+func TestCallEventStream(t *testing.T) {
+	startTestService(t)
+	server := startProxy(t)
+
+	request := newRequest(t, http.MethodPost, server.URL+"/", `{"method": "org.example.test.Count", "parameters": {"count": 3}}`)
+	request.Header.Set("Accept", "text/event-stream")
+	response, body := do(t, request)
+	checkStatus(t, response, body, http.StatusOK)
+
+	if contentType := response.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("got Content-Type %q, expected text/event-stream", contentType)
+	}
+	expected := "data: {\"parameters\":{\"i\":0}}\n\n" +
+		"data: {\"parameters\":{\"i\":1}}\n\n" +
+		"data: {\"parameters\":{\"i\":2}}\n\n"
+	if body != expected {
+		t.Errorf("got %q, expected %q", body, expected)
+	}
+}
+
+func TestInterfacePage(t *testing.T) {
+	startTestService(t)
+	server := startProxy(t)
+
+	response, body := do(t, newRequest(t, http.MethodGet, server.URL+"/interface/org.example.test", ""))
+	checkStatus(t, response, body, http.StatusOK)
+
+	if !strings.Contains(body, "Interface of the test service.") {
+		t.Errorf("interface documentation missing from page:\n%s", body)
+	}
+}
+
+func TestInterfaceDescriptionRange(t *testing.T) {
+	startTestService(t)
+	server := startProxy(t)
+	url := server.URL + "/interface/org.example.test.varlink"
+
+	response, body := getRange(t, url, "bytes=2-10")
+	checkStatus(t, response, body, http.StatusPartialContent)
+	if expected := testDescription[2:11]; body != expected {
+		t.Errorf("got %q, expected %q", body, expected)
+	}
+	if expected := fmt.Sprintf("bytes 2-10/%d", len(testDescription)); response.Header.Get("Content-Range") != expected {
+		t.Errorf("got Content-Range %q, expected %q", response.Header.Get("Content-Range"), expected)
+	}
+	if contentType := response.Header.Get("Content-Type"); contentType != "text/plain; charset=utf-8" {
+		t.Errorf("got Content-Type %q", contentType)
+	}
+
+	response, body = getRange(t, url, "bytes=-8")
+	checkStatus(t, response, body, http.StatusPartialContent)
+	if expected := testDescription[len(testDescription)-8:]; body != expected {
+		t.Errorf("got %q, expected %q", body, expected)
+	}
+
+	response, body = getRange(t, url, fmt.Sprintf("bytes=%d-", len(testDescription)+10))
+	checkStatus(t, response, body, http.StatusRequestedRangeNotSatisfiable)
+
+	response, body = get(t, url)
+	checkStatus(t, response, body, http.StatusOK)
+	if body != testDescription || response.Header.Get("Accept-Ranges") != "bytes" {
+		t.Errorf("got %q with Accept-Ranges %q, expected the whole description", body, response.Header.Get("Accept-Ranges"))
+	}
+
+	response, body = do(t, newRequest(t, http.MethodHead, url, ""))
+	checkStatus(t, response, body, http.StatusOK)
+	if response.ContentLength != int64(len(testDescription)) {
+		t.Errorf("HEAD: got Content-Length %d, expected %d", response.ContentLength, len(testDescription))
+	}
+}
+
+func TestCallNUL(t *testing.T) {
+	startTestService(t)
+	server := startProxy(t)
+
+	// an escaped NUL is a valid character of a string
+	for _, path := range []string{"/", "/?raw=true", "/?collect=true"} {
+		response, body := post(t, server.URL+path, `{"method": "org.example.test.Echo", "parameters": {"text": "a\u0000b", "number": 1}}`)
+		checkStatus(t, response, body, http.StatusOK)
+		if !strings.Contains(body, `"text":"a\u0000b"`) {
+			t.Errorf("%s: got %s, expected the text with an escaped NUL", path, body)
+		}
+	}
+
+	request := newRequest(t, http.MethodPost, server.URL+"/", `{"method": "org.example.test.Echo", "parameters": {"text": "a\u0000b", "number": 1}}`)
+	request.Header.Set(sessionHeader, openSession(t, server.URL))
+	response, body := do(t, request)
+	checkStatus(t, response, body, http.StatusOK)
+	if !strings.Contains(body, `"text":"a\u0000b"`) {
+		t.Errorf("session: got %s, expected the text with an escaped NUL", body)
+	}
+
+	// a raw NUL is not valid JSON, and must not end the varlink message
+	for _, path := range []string{"/", "/?raw=true", "/call/org.example.test.Echo"} {
+		call := "{\"method\": \"org.example.test.Echo\", \"parameters\": {\"text\": \"a\x00b\", \"number\": 1}}"
+		if strings.HasPrefix(path, "/call/") {
+			call = "{\"text\": \"a\x00b\", \"number\": 1}"
+		}
+		response, body := post(t, server.URL+path, call)
+		checkStatus(t, response, body, http.StatusBadRequest)
+	}
+
+	// the connections are still usable
+	response, body = post(t, server.URL+"/", `{"method": "org.example.test.Echo", "parameters": {"text": "after", "number": 2}}`)
+	checkStatus(t, response, body, http.StatusOK)
+	if !strings.Contains(body, `"text":"after"`) {
+		t.Errorf("got %s after a NUL", body)
+	}
+}
+
+func TestCheckMethods(t *testing.T) {
+	// the service answers a method its description does not declare
+	var calls int32
+	iface := newTestInterface()
+	iface.methods["Undeclared"] = func(c varlink.Call) error {
+		atomic.AddInt32(&calls, 1)
+		return c.Reply(nil)
+	}
+	startTestService(t, iface)
+	setFlag(t, "check-methods", "true")
+	server := startProxy(t)
+	output := captureLog(t)
+
+	response, body := post(t, server.URL+"/", `{"method": "org.example.test.Undeclared"}`)
+	checkStatus(t, response, body, http.StatusNotFound)
+
+	var reply struct {
+		Error      string
+		Parameters map[string]string
+	}
+	if err := json.Unmarshal([]byte(body), &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Error != "org.varlink.service.MethodNotFound" || reply.Parameters["method"] != "org.example.test.Undeclared" ||
+		reply.Parameters["message"] != "method Undeclared not declared by interface org.example.test" {
+		t.Errorf("got %s", body)
+	}
+	if n := atomic.LoadInt32(&calls); n != 0 {
+		t.Errorf("the service was called %d times", n)
+	}
+	if output.String() != "" {
+		t.Errorf("logged %q", output.String())
+	}
+
+	// declared methods are called
+	response, body = post(t, server.URL+"/", `{"method": "org.example.test.Nothing"}`)
+	checkStatus(t, response, body, http.StatusOK)
+
+	// without the check, the service is reached
+	setFlag(t, "check-methods", "false")
+	response, body = post(t, server.URL+"/", `{"method": "org.example.test.Undeclared"}`)
+	checkStatus(t, response, body, http.StatusOK)
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("the service was called %d times, expected once", n)
+	}
+}
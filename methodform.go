@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/varlink/go/varlink"
+	"github.com/varlink/go/varlink/idl"
+)
+
+// methodByName returns the method of i called name, or nil.
+func methodByName(i *idl.IDL, name string) *idl.Method {
+	for _, m := range i.Methods {
+		if m.Name == name {
+			return m
+		}
+	}
+
+	return nil
+}
+
+// callReply calls the method of call and returns the parameters of its
+// single reply.
+func callReply(call methodCall) (json.RawMessage, error) {
+	if err := checkMethodName(call.Method); err != nil {
+		return nil, err
+	}
+	iface := call.Method[:strings.LastIndex(call.Method, ".")]
+
+	c, _, err := connect(iface, call.Address)
+	if err != nil {
+		return nil, err
+	}
+	defer closeConnection(c)
+
+	var raw json.RawMessage
+	start := time.Now()
+	receive, err := c.Send(call.Method, callParameters(call.Parameters), 0)
+	if err == nil {
+		_, err = receive(&raw)
+	}
+	logSlowCall(iface, call.Method, start)
+
+	return raw, err
+}
+
+// serveMethodForm serves the method page at /interface/NAME/call/METHOD,
+// which works without JavaScript: the form on it posts the parameters back
+// to the same URL, and the reply of the call is shown below the form.
+func serveMethodForm(writer http.ResponseWriter, request *http.Request, i *idl.IDL, name string) {
+	method := methodByName(i, name)
+	if method == nil {
+		httpError(writer, request, "Method does not exist: "+name, http.StatusNotFound)
+		return
+	}
+
+	data := map[string]interface{}{
+		"Interface":     i,
+		"Method":        method,
+		"ErrorExamples": errorExamples(i),
+	}
+
+	if request.Method == http.MethodPost {
+		parameters := request.PostFormValue("parameters")
+		data["DefaultInArgs"] = parameters
+		data["Reply"], data["ReplyError"] = formReply(request, i.Name+"."+method.Name, parameters)
+	} else {
+		value, err := json.MarshalIndent(defaultValue(i, method.In), "", "  ")
+		if err != nil {
+			httpError(writer, request, "Internal server error", http.StatusInternalServerError)
+			log.Print(err.Error())
+			return
+		}
+		data["DefaultInArgs"] = string(value)
+	}
+
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	executeTemplate(writer, "method.html", data)
+}
+
+// formReply calls method with the parameters posted in the method form and
+// returns its indented reply, or the text of the error which occurred.
+func formReply(request *http.Request, method string, parameters string) (string, string) {
+	call := methodCall{Method: method, Address: request.URL.Query().Get("address")}
+	if strings.TrimSpace(parameters) != "" {
+		decoder := json.NewDecoder(strings.NewReader(parameters))
+		decoder.UseNumber()
+		if err := decoder.Decode(&call.Parameters); err != nil {
+			return "", "Invalid parameters: " + err.Error()
+		}
+	}
+
+	iface := method[:strings.LastIndex(method, ".")]
+	if ok, _ := callRateLimiter.allow(iface, request.RemoteAddr); !ok {
+		return "", "Rate limit exceeded"
+	}
+	if !callLimiter.acquire(iface) {
+		return "", "Too many requests"
+	}
+	defer callLimiter.release(iface)
+
+	raw, err := callReply(call)
+	if err != nil {
+		if verr, ok := err.(*varlink.Error); ok && verr.Parameters != nil {
+			b, _ := json.MarshalIndent(verr.Parameters, "", "  ")
+			return "", verr.Name + "\n" + string(b)
+		}
+		return "", err.Error()
+	}
+
+	if len(raw) == 0 {
+		// replies without output parameters may omit them
+		raw = json.RawMessage("{}")
+	}
+
+	var reply bytes.Buffer
+	if err := json.Indent(&reply, raw, "", "  "); err != nil {
+		return "", err.Error()
+	}
+
+	return reply.String(), ""
+}
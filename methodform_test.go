@@ -0,0 +1,52 @@
+package main
+
+import (
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// postForm posts the parameters in the form of a method page.
+func postForm(t *testing.T, server string, method string, parameters string) string {
+	t.Helper()
+
+	form := url.Values{"parameters": {parameters}}
+	request := newRequest(t, http.MethodPost, server+"/interface/org.example.test/call/"+method, form.Encode())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response, body := do(t, request)
+	checkStatus(t, response, body, http.StatusOK)
+
+	return html.UnescapeString(body)
+}
+
+func TestMethodFormWithoutParameters(t *testing.T) {
+	startTestService(t)
+	server := startProxy(t)
+
+	for _, parameters := range []string{"", "{}"} {
+		body := postForm(t, server.URL, "Nothing", parameters)
+		if strings.Contains(body, `class="error"`) {
+			t.Errorf("%q: got an error:\n%s", parameters, body)
+		}
+		if !strings.Contains(body, "<pre>{}</pre>") {
+			t.Errorf("%q: reply missing:\n%s", parameters, body)
+		}
+	}
+}
+
+func TestMethodFormReply(t *testing.T) {
+	startTestService(t)
+	server := startProxy(t)
+
+	body := postForm(t, server.URL, "Echo", `{"text": "form", "number": 3}`)
+	if expected := "<pre>{\n  \"number\": 3,\n  \"text\": \"form\"\n}</pre>"; !strings.Contains(body, expected) {
+		t.Errorf("reply %q missing:\n%s", expected, body)
+	}
+
+	body = postForm(t, server.URL, "Fail", "")
+	if !strings.Contains(body, "org.example.test.Failed") {
+		t.Errorf("error missing:\n%s", body)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// wantsMsgpack returns true if the client accepts MessagePack replies.
+func wantsMsgpack(request *http.Request) bool {
+	return negotiate(request, []string{"application/json", "application/msgpack"}) == "application/msgpack"
+}
+
+// writeMsgpack writes v, which is converted to JSON first, as MessagePack.
+func writeMsgpack(writer http.ResponseWriter, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	if err := encodeMsgpack(&out, value); err != nil {
+		return err
+	}
+
+	writer.Header().Set("Content-Type", "application/msgpack")
+	_, err = writer.Write(out.Bytes())
+	return err
+}
+
+// writeMsgpackHeader writes the type and length of a string, array or map
+// of n elements, in the shortest of the fix, 8 (if not 0), 16 or 32 bit
+// length formats.
+func writeMsgpackHeader(b *bytes.Buffer, n int, fix byte, fixMax int, code8 byte, code16 byte, code32 byte) {
+	switch {
+	case n <= fixMax:
+		b.WriteByte(fix | byte(n))
+	case code8 != 0 && n <= math.MaxUint8:
+		b.WriteByte(code8)
+		b.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		b.WriteByte(code16)
+		binary.Write(b, binary.BigEndian, uint16(n))
+	default:
+		b.WriteByte(code32)
+		binary.Write(b, binary.BigEndian, uint32(n))
+	}
+}
+
+// writeMsgpackInt writes n in the shortest of the fixint and 8, 16, 32 or
+// 64 bit integer formats.
+func writeMsgpackInt(b *bytes.Buffer, n int64) {
+	switch {
+	case n >= 0:
+		writeMsgpackUint(b, uint64(n))
+	case n >= -32:
+		b.WriteByte(byte(n))
+	case n >= math.MinInt8:
+		b.WriteByte(0xd0)
+		b.WriteByte(byte(n))
+	case n >= math.MinInt16:
+		b.WriteByte(0xd1)
+		binary.Write(b, binary.BigEndian, int16(n))
+	case n >= math.MinInt32:
+		b.WriteByte(0xd2)
+		binary.Write(b, binary.BigEndian, int32(n))
+	default:
+		b.WriteByte(0xd3)
+		binary.Write(b, binary.BigEndian, n)
+	}
+}
+
+// writeMsgpackUint writes n in the shortest of the positive fixint and 8,
+// 16, 32 or 64 bit unsigned integer formats.
+func writeMsgpackUint(b *bytes.Buffer, n uint64) {
+	switch {
+	case n <= 0x7f:
+		b.WriteByte(byte(n))
+	case n <= math.MaxUint8:
+		b.WriteByte(0xcc)
+		b.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		b.WriteByte(0xcd)
+		binary.Write(b, binary.BigEndian, uint16(n))
+	case n <= math.MaxUint32:
+		b.WriteByte(0xce)
+		binary.Write(b, binary.BigEndian, uint32(n))
+	default:
+		b.WriteByte(0xcf)
+		binary.Write(b, binary.BigEndian, n)
+	}
+}
+
+// encodeMsgpack encodes a value decoded from JSON with UseNumber.
+func encodeMsgpack(b *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		b.WriteByte(0xc0)
+
+	case bool:
+		if v {
+			b.WriteByte(0xc3)
+		} else {
+			b.WriteByte(0xc2)
+		}
+
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			writeMsgpackInt(b, n)
+			return nil
+		}
+		if n, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			writeMsgpackUint(b, n)
+			return nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return err
+		}
+		b.WriteByte(0xcb)
+		binary.Write(b, binary.BigEndian, f)
+
+	case string:
+		writeMsgpackHeader(b, len(v), 0xa0, 31, 0xd9, 0xda, 0xdb)
+		b.WriteString(v)
+
+	case []interface{}:
+		writeMsgpackHeader(b, len(v), 0x90, 15, 0, 0xdc, 0xdd)
+		for _, element := range v {
+			if err := encodeMsgpack(b, element); err != nil {
+				return err
+			}
+		}
+
+	case map[string]interface{}:
+		// sorted, so equal values are encoded the same way
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		writeMsgpackHeader(b, len(v), 0x80, 15, 0, 0xde, 0xdf)
+		for _, key := range keys {
+			if err := encodeMsgpack(b, key); err != nil {
+				return err
+			}
+			if err := encodeMsgpack(b, v[key]); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("cannot encode %T as MessagePack", v)
+	}
+
+	return nil
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// decodeMsgpack decodes a value written by encodeMsgpack, with integers as
+// int64, except for the 64 bit unsigned format decoded as uint64, and floats
+// as float64.
+func decodeMsgpack(r *bytes.Reader) (interface{}, error) {
+	code, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	read := func(v interface{}) error {
+		return binary.Read(r, binary.BigEndian, v)
+	}
+	length := func(size int) (int, error) {
+		switch size {
+		case 1:
+			var n uint8
+			err := read(&n)
+			return int(n), err
+		case 2:
+			var n uint16
+			err := read(&n)
+			return int(n), err
+		default:
+			var n uint32
+			err := read(&n)
+			return int(n), err
+		}
+	}
+	str := func(n int) (interface{}, error) {
+		s := make([]byte, n)
+		_, err := io.ReadFull(r, s)
+		return string(s), err
+	}
+	array := func(n int) (interface{}, error) {
+		a := make([]interface{}, n)
+		for i := range a {
+			var err error
+			if a[i], err = decodeMsgpack(r); err != nil {
+				return nil, err
+			}
+		}
+		return a, nil
+	}
+	object := func(n int) (interface{}, error) {
+		m := make(map[string]interface{}, n)
+		for i := 0; i < n; i++ {
+			key, err := decodeMsgpack(r)
+			if err != nil {
+				return nil, err
+			}
+			if m[key.(string)], err = decodeMsgpack(r); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+
+	switch {
+	case code <= 0x7f:
+		return int64(code), nil
+	case code >= 0xe0:
+		return int64(int8(code)), nil
+	case code&0xe0 == 0xa0:
+		return str(int(code & 0x1f))
+	case code&0xf0 == 0x90:
+		return array(int(code & 0x0f))
+	case code&0xf0 == 0x80:
+		return object(int(code & 0x0f))
+	}
+
+	switch code {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcc:
+		var n uint8
+		err := read(&n)
+		return int64(n), err
+	case 0xcd:
+		var n uint16
+		err := read(&n)
+		return int64(n), err
+	case 0xce:
+		var n uint32
+		err := read(&n)
+		return int64(n), err
+	case 0xcf:
+		var n uint64
+		err := read(&n)
+		return n, err
+	case 0xd0:
+		var n int8
+		err := read(&n)
+		return int64(n), err
+	case 0xd1:
+		var n int16
+		err := read(&n)
+		return int64(n), err
+	case 0xd2:
+		var n int32
+		err := read(&n)
+		return int64(n), err
+	case 0xd3:
+		var n int64
+		err := read(&n)
+		return n, err
+	case 0xcb:
+		var f float64
+		err := read(&f)
+		return f, err
+	case 0xd9, 0xda, 0xdb:
+		n, err := length(1 << (code - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return str(n)
+	case 0xdc, 0xdd:
+		n, err := length(2 << (code - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return array(n)
+	case 0xde, 0xdf:
+		n, err := length(2 << (code - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return object(n)
+	}
+
+	return nil, fmt.Errorf("unexpected code %#x", code)
+}
+
+func TestMsgpack(t *testing.T) {
+	long := func(n int) string {
+		return strings.Repeat("a", n)
+	}
+
+	for _, test := range []struct {
+		json   string
+		prefix string
+		value  interface{}
+	}{
+		{`null`, "c0", nil},
+		{`false`, "c2", false},
+		{`true`, "c3", true},
+		{`0`, "00", int64(0)},
+		{`127`, "7f", int64(127)},
+		{`-1`, "ff", int64(-1)},
+		{`-32`, "e0", int64(-32)},
+		{`128`, "cc80", int64(128)},
+		{`-33`, "d0df", int64(-33)},
+		{`65535`, "cdffff", int64(65535)},
+		{`-32768`, "d18000", int64(-32768)},
+		{`4294967295`, "ceffffffff", int64(math.MaxUint32)},
+		{`-2147483649`, "d3ffffffff7fffffff", int64(math.MinInt32 - 1)},
+		{`9223372036854775807`, "cf7fffffffffffffff", uint64(math.MaxInt64)},
+		{`18446744073709551615`, "cfffffffffffffffff", uint64(math.MaxUint64)},
+		{`1.5`, "cb3ff8000000000000", 1.5},
+		{`18446744073709551616`, "cb43f0000000000000", 18446744073709551616.0},
+		{`""`, "a0", ""},
+		{`"` + long(31) + `"`, "bf", long(31)},
+		{`"` + long(32) + `"`, "d920", long(32)},
+		{`"` + long(256) + `"`, "da0100", long(256)},
+		{`"` + long(65536) + `"`, "db00010000", long(65536)},
+		{`[]`, "90", []interface{}{}},
+		{`[1, "a", [null]]`, "9301a161" + "91c0", []interface{}{int64(1), "a", []interface{}{nil}}},
+		{`[` + strings.Repeat(`0,`, 15) + `0]`, "dc0010", repeated(16, int64(0))},
+		{`{}`, "80", map[string]interface{}{}},
+		{`{"b": true, "a": {"c": 1}}`, "82a161" + "81a16301" + "a162c3", map[string]interface{}{
+			"a": map[string]interface{}{"c": int64(1)},
+			"b": true,
+		}},
+	} {
+		var v interface{}
+		decoder := json.NewDecoder(strings.NewReader(test.json))
+		decoder.UseNumber()
+		if err := decoder.Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+
+		var b bytes.Buffer
+		if err := encodeMsgpack(&b, v); err != nil {
+			t.Errorf("%.40s: %s", test.json, err)
+			continue
+		}
+
+		encoded := hex.EncodeToString(b.Bytes())
+		if !strings.HasPrefix(encoded, test.prefix) {
+			t.Errorf("%.40s: got %.40s, expected %s", test.json, encoded, test.prefix)
+		}
+
+		r := bytes.NewReader(b.Bytes())
+		decoded, err := decodeMsgpack(r)
+		if err != nil {
+			t.Errorf("%.40s: decoding %.40s: %s", test.json, encoded, err)
+			continue
+		}
+		if r.Len() != 0 {
+			t.Errorf("%.40s: %d bytes left after the value", test.json, r.Len())
+		}
+		if !reflect.DeepEqual(decoded, test.value) {
+			t.Errorf("%.40s: got %#v, expected %#v", test.json, decoded, test.value)
+		}
+	}
+}
+
+// repeated returns an array of n elements v.
+func repeated(n int, v interface{}) []interface{} {
+	a := make([]interface{}, n)
+	for i := range a {
+		a[i] = v
+	}
+
+	return a
+}
+
+func TestMsgpackAccept(t *testing.T) {
+	startTestService(t)
+	server := startProxy(t)
+
+	call := `{"method": "org.example.test.Echo", "parameters": {"text": "msgpack", "number": 300}}`
+	for _, test := range []struct {
+		accept  string
+		msgpack bool
+	}{
+		{"application/msgpack", true},
+		{"application/json;q=0.5, application/msgpack", true},
+		{"application/json, application/msgpack;q=0.5", false},
+		{"*/*", false},
+	} {
+		request := newRequest(t, http.MethodPost, server.URL+"/", call)
+		request.Header.Set("Accept", test.accept)
+		response, body := do(t, request)
+		checkStatus(t, response, body, http.StatusOK)
+
+		contentType := response.Header.Get("Content-Type")
+		if !test.msgpack {
+			if !strings.HasPrefix(contentType, "application/json") {
+				t.Errorf("%s: got %s, expected JSON", test.accept, contentType)
+			}
+			continue
+		}
+		if contentType != "application/msgpack" {
+			t.Errorf("%s: got %s, expected application/msgpack", test.accept, contentType)
+			continue
+		}
+
+		decoded, err := decodeMsgpack(bytes.NewReader([]byte(body)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := map[string]interface{}{
+			"parameters": map[string]interface{}{"text": "msgpack", "number": int64(300)},
+		}
+		if !reflect.DeepEqual(decoded, expected) {
+			t.Errorf("%s: got %v, expected %v", test.accept, decoded, expected)
+		}
+	}
+
+	// errors are JSON
+	request := newRequest(t, http.MethodPost, server.URL+"/", `{"method": "org.example.test.Fail"}`)
+	request.Header.Set("Accept", "application/msgpack")
+	response, body := do(t, request)
+	if contentType := response.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "application/json") {
+		t.Errorf("error: got %s, expected JSON: %s", contentType, body)
+	}
+}
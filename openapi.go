@@ -0,0 +1,310 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/varlink/go/varlink"
+	"github.com/varlink/go/varlink/idl"
+)
+
+// openAPIComponentPrefix is the JSON reference prefix of component schemas.
+const openAPIComponentPrefix = "#/components/schemas/"
+
+// openAPIGenerator translates varlink types to OpenAPI schemas. Type aliases
+// are emitted once as shared component schemas, named by their fully
+// qualified name, and referenced with $ref from every place they are used.
+type openAPIGenerator struct {
+	idl        *idl.IDL
+	components map[string]interface{}
+}
+
+// undefinedAlias returns the name of a type alias which a type of i refers
+// to without declaring it, or an empty string.
+func undefinedAlias(i *idl.IDL) string {
+	declared := make(map[string]bool, len(i.Aliases))
+	for _, alias := range i.Aliases {
+		declared[alias.Name] = true
+	}
+
+	var undefined func(t *idl.Type) string
+	undefined = func(t *idl.Type) string {
+		if t == nil {
+			return ""
+		}
+
+		switch t.Kind {
+		case idl.TypeAlias:
+			if !declared[t.Alias] {
+				return t.Alias
+			}
+
+		case idl.TypeArray, idl.TypeMap, idl.TypeMaybe:
+			return undefined(t.ElementType)
+
+		case idl.TypeStruct:
+			for _, field := range t.Fields {
+				if name := undefined(field.Type); name != "" {
+					return name
+				}
+			}
+		}
+
+		return ""
+	}
+
+	for _, member := range i.Members {
+		var types []*idl.Type
+		switch m := member.(type) {
+		case *idl.Alias:
+			types = []*idl.Type{m.Type}
+		case *idl.Method:
+			types = []*idl.Type{m.In, m.Out}
+		case *idl.Error:
+			types = []*idl.Type{m.Type}
+		}
+
+		for _, t := range types {
+			if name := undefined(t); name != "" {
+				return name
+			}
+		}
+	}
+
+	return ""
+}
+
+// checkAliases returns an error if a type of i refers to a type alias which
+// i does not declare, which could not be referenced in an OpenAPI document.
+func checkAliases(i *idl.IDL) error {
+	if name := undefinedAlias(i); name != "" {
+		return &varlink.Error{
+			Name: "org.varlink.http.InvalidServiceDescription",
+			Parameters: map[string]string{
+				"interface": i.Name,
+				"message":   "undefined type " + name,
+			},
+		}
+	}
+
+	return nil
+}
+
+func (g *openAPIGenerator) alias(name string) string {
+	qualified := g.idl.Name + "." + name
+	if _, ok := g.components[qualified]; ok {
+		return qualified
+	}
+
+	for _, alias := range g.idl.Aliases {
+		if alias.Name == name {
+			// Reserve the name before descending, aliases may refer to
+			// each other.
+			g.components[qualified] = nil
+			g.components[qualified] = g.schema(alias.Type)
+			break
+		}
+	}
+
+	return qualified
+}
+
+func (g *openAPIGenerator) schema(t *idl.Type) map[string]interface{} {
+	switch t.Kind {
+	case idl.TypeBool:
+		return map[string]interface{}{"type": "boolean"}
+
+	case idl.TypeInt:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+
+	case idl.TypeFloat:
+		return map[string]interface{}{"type": "number", "format": "double"}
+
+	case idl.TypeString:
+		return map[string]interface{}{"type": "string"}
+
+	case idl.TypeObject:
+		return map[string]interface{}{}
+
+	case idl.TypeArray:
+		return map[string]interface{}{
+			"type":  "array",
+			"items": g.schema(t.ElementType),
+		}
+
+	case idl.TypeMap:
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": g.schema(t.ElementType),
+		}
+
+	case idl.TypeMaybe:
+		// $ref does not allow sibling keywords, wrap it
+		return map[string]interface{}{
+			"allOf":    []interface{}{g.schema(t.ElementType)},
+			"nullable": true,
+		}
+
+	case idl.TypeEnum:
+		values := make([]string, 0, len(t.Fields))
+		for _, field := range t.Fields {
+			values = append(values, field.Name)
+		}
+		return map[string]interface{}{"type": "string", "enum": values}
+
+	case idl.TypeStruct:
+		properties := newOrderedObject()
+		required := make([]string, 0)
+		for _, field := range t.Fields {
+			properties.set(field.Name, g.schema(field.Type))
+			if field.Type.Kind != idl.TypeMaybe {
+				required = append(required, field.Name)
+			}
+		}
+		s := map[string]interface{}{
+			"type":       "object",
+			"properties": properties,
+		}
+		if len(required) > 0 {
+			s["required"] = required
+		}
+		return s
+
+	case idl.TypeAlias:
+		return map[string]interface{}{"$ref": openAPIComponentPrefix + g.alias(t.Alias)}
+	}
+
+	return map[string]interface{}{}
+}
+
+// openAPI returns an OpenAPI 3 document describing the methods of the given
+// interfaces, as they can be called with serveCall on the proxy at server.
+// It fails if an interface refers to an undefined type.
+func openAPI(server string, interfaces ...*idl.IDL) (map[string]interface{}, error) {
+	g := &openAPIGenerator{
+		components: make(map[string]interface{}),
+	}
+
+	for _, i := range interfaces {
+		if err := checkAliases(i); err != nil {
+			return nil, err
+		}
+	}
+
+	paths := make(map[string]interface{})
+	for _, i := range interfaces {
+		g.idl = i
+		for _, m := range i.Methods {
+			operation := map[string]interface{}{
+				"operationId": i.Name + "." + m.Name,
+				"tags":        []string{i.Name},
+				"requestBody": map[string]interface{}{
+					"content": map[string]interface{}{
+						"application/json": map[string]interface{}{
+							"schema": g.schema(m.In),
+						},
+					},
+				},
+				"responses": map[string]interface{}{
+					"200": map[string]interface{}{
+						"description": "Method reply",
+						"content": map[string]interface{}{
+							"application/json": map[string]interface{}{
+								"schema": map[string]interface{}{
+									"type": "object",
+									"properties": map[string]interface{}{
+										"parameters": g.schema(m.Out),
+									},
+								},
+							},
+						},
+					},
+				},
+			}
+			if m.Doc != "" {
+				operation["description"] = m.Doc
+			}
+
+			paths["/call/"+i.Name+"."+m.Name] = map[string]interface{}{
+				"post": operation,
+			}
+		}
+	}
+
+	info := map[string]interface{}{
+		"title":   "varlink",
+		"version": "1",
+	}
+	if len(interfaces) == 1 {
+		info["title"] = interfaces[0].Name
+		if interfaces[0].Doc != "" {
+			info["description"] = interfaces[0].Doc
+		}
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info":    info,
+		"servers": []interface{}{
+			map[string]string{"url": server},
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": g.components,
+		},
+	}, nil
+}
+
+// serveOpenAPI serves an OpenAPI document for all interfaces known to the
+// resolver. It fails like the document of a single interface if one of the
+// interfaces cannot be described.
+func serveOpenAPI(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		httpError(writer, request, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var names []string
+	err := resolver.getInfo(nil, nil, nil, nil, &names)
+	if err != nil {
+		callError(writer, request, err)
+		return
+	}
+
+	descriptions := make([]*idl.IDL, 0, len(names))
+	for _, name := range allowedInterfaces(names) {
+		i, err := interfaces.describe(name)
+		if err != nil {
+			callError(writer, request, err)
+			return
+		}
+		descriptions = append(descriptions, i)
+	}
+
+	document, err := openAPI(baseURL(request), descriptions...)
+	if err != nil {
+		callError(writer, request, err)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	newEncoder(writer, request).Encode(document)
+}
+
+// serveDocs serves an interactive API documentation page for the OpenAPI
+// document of one interface, or of all interfaces.
+func serveDocs(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		httpError(writer, request, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	spec := baseURL(request) + "/openapi.json"
+	if name := request.URL.Query().Get("interface"); name != "" {
+		spec = baseURL(request) + "/interface/" + name + "/openapi.json"
+	}
+
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	executeTemplate(writer, "docs.html", map[string]interface{}{
+		"SpecURL": spec,
+	})
+}
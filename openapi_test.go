@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/varlink/go/varlink/idl"
+)
+
+// generateOpenAPI parses description and returns the OpenAPI document of
+// it as JSON.
+func generateOpenAPI(t *testing.T, description string) string {
+	t.Helper()
+
+	i, err := idl.New(description)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	document, err := openAPI("http://localhost", i)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(b)
+}
+
+func TestOpenAPISharedAlias(t *testing.T) {
+	b := generateOpenAPI(t, `interface org.example.test
+type Inner (value: int)
+type Item (name: string, inner: Inner)
+method Get(name: string) -> (item: Item)
+method Put(item: Item) -> ()
+method List() -> (items: []Item)
+`)
+
+	var document struct {
+		Components struct {
+			Schemas map[string]json.RawMessage
+		}
+	}
+	if err := json.Unmarshal([]byte(b), &document); err != nil {
+		t.Fatal(err)
+	}
+
+	schemas := document.Components.Schemas
+	if len(schemas) != 2 || schemas["org.example.test.Item"] == nil || schemas["org.example.test.Inner"] == nil {
+		t.Errorf("got components %s, expected org.example.test.Item and org.example.test.Inner", b)
+	}
+	if !strings.Contains(string(schemas["org.example.test.Item"]), `"$ref":"#/components/schemas/org.example.test.Inner"`) {
+		t.Errorf("Item does not reference Inner: %s", schemas["org.example.test.Item"])
+	}
+
+	// once in each method, and nowhere else
+	if n := strings.Count(b, `"$ref":"#/components/schemas/org.example.test.Item"`); n != 3 {
+		t.Errorf("got %d references of Item, expected 3: %s", n, b)
+	}
+	if n := strings.Count(b, `"$ref":"#/components/schemas/org.example.test.Inner"`); n != 1 {
+		t.Errorf("got %d references of Inner, expected 1: %s", n, b)
+	}
+}
+
+func TestOpenAPIRecursiveAlias(t *testing.T) {
+	b := generateOpenAPI(t, `interface org.example.test
+type Node (value: int, next: ?Node)
+method Get() -> (node: Node)
+`)
+
+	if n := strings.Count(b, `"$ref":"#/components/schemas/org.example.test.Node"`); n != 2 {
+		t.Errorf("got %d references of Node, expected 2: %s", n, b)
+	}
+}
+
+func TestOpenAPIUndefinedAlias(t *testing.T) {
+	for _, description := range []string{
+		"interface org.example.test\nmethod Get() -> (item: Missing)\n",
+		"interface org.example.test\nmethod Get(items: [string][]?Missing) -> ()\n",
+		"interface org.example.test\ntype Item (missing: Missing)\nmethod Get() -> ()\n",
+		"interface org.example.test\nmethod Get() -> ()\nerror Failed (missing: Missing)\n",
+	} {
+		i, err := idl.New(description)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := openAPI("http://localhost", i); err == nil {
+			t.Errorf("%q: expected an error", description)
+		}
+	}
+}
+
+func TestOpenAPIEndpointUndefinedAlias(t *testing.T) {
+	iface := newTestInterface()
+	iface.description = "interface org.example.test\nmethod Get() -> (item: Missing)\n"
+	startTestService(t, iface)
+	server := startProxy(t)
+
+	response, body := get(t, server.URL+"/interface/org.example.test/openapi.json")
+	if response.StatusCode != http.StatusBadGateway || !strings.Contains(body, "org.varlink.http.InvalidServiceDescription") {
+		t.Errorf("got %d %s, expected org.varlink.http.InvalidServiceDescription", response.StatusCode, body)
+	}
+}
+
+func TestOpenAPIKeepsDeclarationOrder(t *testing.T) {
+	b := generateOpenAPI(t, unorderedDescription)
+
+	if !strings.Contains(b, `"properties":{"zebra":{"format":"int64","type":"integer"},"apple":{"type":"string"},"mango":{"type":"boolean"}}`) {
+		t.Errorf("properties of Omega not in declaration order: %s", b)
+	}
+}
+
+func TestOpenAPIEndpointUnresolvedInterface(t *testing.T) {
+	// the interface is listed, but not resolved to a service
+	startResolver(t, nil, []string{"org.example.missing"})
+	server := startProxy(t)
+
+	response, body := get(t, server.URL+"/openapi.json")
+	checkStatus(t, response, body, http.StatusNotFound)
+	if !strings.Contains(body, "org.varlink.resolver.InterfaceNotFound") {
+		t.Errorf("got %s, expected org.varlink.resolver.InterfaceNotFound", body)
+	}
+}
+
+func TestOpenAPIEndpointInvalidInterface(t *testing.T) {
+	iface := newTestInterface()
+	iface.description = "interface org.example.test\nmethod Get() -> (item: Missing)\n"
+	startTestService(t, iface)
+	server := startProxy(t)
+
+	response, body := get(t, server.URL+"/openapi.json")
+	checkStatus(t, response, body, http.StatusBadGateway)
+	if !strings.Contains(body, "org.varlink.http.InvalidServiceDescription") {
+		t.Errorf("got %s, expected org.varlink.http.InvalidServiceDescription", body)
+	}
+}
+
+func TestOpenAPIEndpointWithoutResolver(t *testing.T) {
+	setFlag(t, "resolver-address", "unix:"+t.TempDir()+"/missing")
+	server := startProxy(t)
+
+	response, body := get(t, server.URL+"/openapi.json")
+	if response.StatusCode < 500 || strings.Contains(body, "org.varlink.http.NotFound") {
+		t.Errorf("got %d %s, expected a server error", response.StatusCode, body)
+	}
+}
@@ -24,7 +24,7 @@ mkdir -p build/src/github.com/varlink
 ln -s $(pwd) build/src/github.com/varlink/%{name}
 export GOPATH=$(pwd)/build
 
-go build -ldflags "-X main.datadir=%{_datadir}/%{name}" github.com/varlink/%{name}
+go build -ldflags "-X main.datadir=%{_datadir}/%{name} -X main.version=%{version}" github.com/varlink/%{name}
 
 %install
 install -d %{buildroot}%{_bindir}
@@ -49,6 +49,9 @@ install -m 0644 static/* -t %{buildroot}%{_datadir}/%{name}
 %{_unitdir}/%{name}.service
 %{_unitdir}/%{name}.socket
 %dir %{_datadir}/%{name}
+%{_datadir}/%{name}/docs.html
+%{_datadir}/%{name}/docs.js
+%{_datadir}/%{name}/error.html
 %{_datadir}/%{name}/favicon.ico
 %{_datadir}/%{name}/index.html
 %{_datadir}/%{name}/interface.html
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"expvar"
+	"flag"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/varlink/go/varlink"
+)
+
+var poolMaxIdle = flag.Int("pool-max-idle", 2, "keep up to `n` idle connections per tcp service address for reuse (0 disables)")
+var poolIdleTimeout = flag.Duration("pool-idle-timeout", 90*time.Second, "close pooled connections after being idle for `duration`")
+var poolUnix = flag.Bool("pool-unix", false, "also pool connections to unix socket services")
+var maxConnections = flag.Int("max-connections", 0, "maximum `number` of open connections to services, including pooled ones (0 is unlimited)")
+var connectionQueueTimeout = flag.Duration("connection-queue-timeout", 0, "wait up to `duration` for a connection slot before rejecting a call")
+
+// openConnections counts the open connections to services, it is published
+// at /debug/vars.
+var openConnections = expvar.NewInt("connections")
+
+// connectionSlots holds one element per open connection if -max-connections
+// is set.
+var connectionSlots chan struct{}
+
+type idleConnection struct {
+	connection *varlink.Connection
+	since      time.Time
+}
+
+// connectionPool keeps idle connections to services, keyed by address, to
+// save dialing them for every call.
+type connectionPool struct {
+	mutex sync.Mutex
+	idle  map[string][]idleConnection
+}
+
+var pool = connectionPool{idle: make(map[string][]idleConnection)}
+
+func pooled(address string) bool {
+	if *poolMaxIdle <= 0 {
+		return false
+	}
+
+	return strings.HasPrefix(address, "tcp:") || (*poolUnix && strings.HasPrefix(address, "unix:"))
+}
+
+// get returns an idle connection to address which still answers, or nil.
+func (p *connectionPool) get(address string) *varlink.Connection {
+	for {
+		p.mutex.Lock()
+		idle := p.idle[address]
+		if len(idle) == 0 {
+			p.mutex.Unlock()
+			return nil
+		}
+		entry := idle[len(idle)-1]
+		p.idle[address] = idle[:len(idle)-1]
+		p.mutex.Unlock()
+
+		if time.Since(entry.since) < *poolIdleTimeout && entry.connection.Ping(pingTimeout) == nil {
+			return entry.connection
+		}
+		closeConnection(entry.connection)
+	}
+}
+
+// release returns c to the pool if reusable, or closes it. Connections are
+// only reusable if no replies are pending on them.
+func (p *connectionPool) release(address string, c *varlink.Connection, reusable bool) {
+	if !reusable || !pooled(address) {
+		closeConnection(c)
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if len(p.idle[address]) >= *poolMaxIdle {
+		closeConnection(c)
+		return
+	}
+	p.idle[address] = append(p.idle[address], idleConnection{c, time.Now()})
+}
+
+// sweep closes connections idle for longer than -pool-idle-timeout.
+func (p *connectionPool) sweep() {
+	now := time.Now()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for address, idle := range p.idle {
+		kept := idle[:0]
+		for _, entry := range idle {
+			if now.Sub(entry.since) >= *poolIdleTimeout {
+				closeConnection(entry.connection)
+				continue
+			}
+			kept = append(kept, entry)
+		}
+		if len(kept) == 0 {
+			delete(p.idle, address)
+		} else {
+			p.idle[address] = kept
+		}
+	}
+}
+
+// evict closes the longest idle connection, it returns false if the pool
+// is empty.
+func (p *connectionPool) evict() bool {
+	p.mutex.Lock()
+	var oldest string
+	for address, idle := range p.idle {
+		if len(idle) == 0 {
+			continue
+		}
+		if oldest == "" || idle[0].since.Before(p.idle[oldest][0].since) {
+			oldest = address
+		}
+	}
+	if oldest == "" {
+		p.mutex.Unlock()
+		return false
+	}
+
+	entry := p.idle[oldest][0]
+	if len(p.idle[oldest]) == 1 {
+		delete(p.idle, oldest)
+	} else {
+		p.idle[oldest] = p.idle[oldest][1:]
+	}
+	p.mutex.Unlock()
+
+	closeConnection(entry.connection)
+	return true
+}
+
+// sweepPeriodically sweeps the pool once per idle timeout.
+func (p *connectionPool) sweepPeriodically() {
+	if *poolMaxIdle <= 0 || *poolIdleTimeout <= 0 {
+		return
+	}
+
+	go func() {
+		for range time.Tick(*poolIdleTimeout) {
+			p.sweep()
+		}
+	}()
+}
+
+// dial returns a pooled connection to address, or a new one.
+func dial(address string) (*varlink.Connection, error) {
+	if pooled(address) {
+		if c := pool.get(address); c != nil {
+			return c, nil
+		}
+	}
+
+	if err := acquireConnection(); err != nil {
+		return nil, err
+	}
+
+	c, err := varlink.NewConnection(address)
+	if err != nil {
+		releaseConnection()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// acquireConnection takes a connection slot. If none is free, an idle
+// pooled connection is closed to make room, or it waits up to
+// -connection-queue-timeout for one.
+func acquireConnection() error {
+	if connectionSlots != nil {
+		select {
+		case connectionSlots <- struct{}{}:
+		default:
+			pool.evict()
+
+			// take the slot freed by evicting without waiting, with a
+			// zero timeout the timer might win the race against it
+			select {
+			case connectionSlots <- struct{}{}:
+			default:
+				timer := time.NewTimer(*connectionQueueTimeout)
+				defer timer.Stop()
+
+				select {
+				case connectionSlots <- struct{}{}:
+				case <-timer.C:
+					return &varlink.Error{
+						Name:       "org.varlink.http.TooManyConnections",
+						Parameters: map[string]int{"limit": *maxConnections},
+					}
+				}
+			}
+		}
+	}
+
+	openConnections.Add(1)
+	return nil
+}
+
+// releaseConnection frees a connection slot taken with acquireConnection.
+func releaseConnection() {
+	openConnections.Add(-1)
+	if connectionSlots != nil {
+		<-connectionSlots
+	}
+}
+
+// closeConnection closes a connection returned by dial.
+func closeConnection(c *varlink.Connection) {
+	c.Close()
+	releaseConnection()
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/varlink/go/varlink"
+)
+
+// setMaxConnections limits the open connections to services to n until the
+// test ends.
+func setMaxConnections(t *testing.T, n int) {
+	setFlag(t, "max-connections", strconv.Itoa(n))
+	connectionSlots = make(chan struct{}, n)
+	t.Cleanup(func() {
+		connectionSlots = nil
+	})
+}
+
+func TestMaxConnectionsEvictsIdleConnection(t *testing.T) {
+	other := &testInterface{
+		name:        "org.example.other",
+		description: "interface org.example.other\nmethod Nothing() -> ()\n",
+		methods: map[string]func(c varlink.Call) error{
+			"Nothing": func(c varlink.Call) error {
+				return c.Reply(struct{}{})
+			},
+		},
+	}
+	startResolver(t, map[string]string{
+		"org.example.test":  startService(t, newTestInterface()),
+		"org.example.other": startService(t, other),
+	}, nil)
+	setFlag(t, "pool-unix", "true")
+	setFlag(t, "connection-queue-timeout", "0")
+	setMaxConnections(t, 1)
+	server := startProxy(t)
+
+	// every call needs the slot of the connection pooled by the previous
+	// one, which is evicted for it
+	for n := 0; n < 50; n++ {
+		for _, iface := range []string{"org.example.test", "org.example.other"} {
+			response, body := post(t, server.URL+"/", `{"method": "`+iface+`.Nothing"}`)
+			checkStatus(t, response, body, http.StatusOK)
+		}
+	}
+}
+
+func TestMaxConnectionsRejectsCalls(t *testing.T) {
+	startTestService(t)
+	setFlag(t, "connection-queue-timeout", "0")
+	setMaxConnections(t, 1)
+	server := startProxy(t)
+
+	// a session holds the only connection
+	openSession(t, server.URL)
+
+	response, body := post(t, server.URL+"/", `{"method": "org.example.test.Nothing"}`)
+	checkStatus(t, response, body, http.StatusServiceUnavailable)
+}
+
+func TestPoolReusesConnections(t *testing.T) {
+	address := startTestService(t)
+	setFlag(t, "pool-unix", "true")
+	server := startProxy(t)
+
+	opened := openConnections.Value()
+	for n := 0; n < 3; n++ {
+		response, body := post(t, server.URL+"/", `{"method": "org.example.test.Nothing"}`)
+		checkStatus(t, response, body, http.StatusOK)
+	}
+
+	pool.mutex.Lock()
+	idle := len(pool.idle[address])
+	pool.mutex.Unlock()
+	if idle != 1 {
+		t.Errorf("got %d idle connections, expected 1", idle)
+	}
+	if open := openConnections.Value() - opened; open != 1 {
+		t.Errorf("got %d open connections, expected 1", open)
+	}
+}
+
+func TestPoolDoesNotReusePendingConnections(t *testing.T) {
+	address := startTestService(t)
+	setFlag(t, "pool-unix", "true")
+	server := startProxy(t)
+
+	// only the first of the replies is returned, the others are pending
+	response, body := post(t, server.URL+"/", `{"method": "org.example.test.Count", "parameters": {"count": 3}, "more": true}`)
+	checkStatus(t, response, body, http.StatusOK)
+
+	pool.mutex.Lock()
+	idle := len(pool.idle[address])
+	pool.mutex.Unlock()
+	if idle != 0 {
+		t.Errorf("got %d idle connections, expected 0", idle)
+	}
+
+	response, body = post(t, server.URL+"/", `{"method": "org.example.test.Count", "parameters": {"count": 1}}`)
+	checkStatus(t, response, body, http.StatusOK)
+	if expected := `{"parameters":{"i":0}}` + "\n"; body != expected {
+		t.Errorf("got %q, expected %q", body, expected)
+	}
+}
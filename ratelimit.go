@@ -0,0 +1,154 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var rateLimitPerClient = flag.Bool("rate-limit-per-client", false, "apply RATE_LIMITS per client address instead of to all clients together")
+
+// rateLimit allows calls to the interfaces matching pattern at rate calls
+// per second, with bursts of up to burst calls.
+type rateLimit struct {
+	pattern interfacePatterns
+	rate    float64
+	burst   float64
+}
+
+var rateUnits = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+}
+
+// parseRateLimits parses a comma-separated list of PATTERN=COUNT/UNIT rules,
+// like "org.example.*=10/s". The first rule matching an interface applies.
+func parseRateLimits(s string) ([]rateLimit, error) {
+	var limits []rateLimit
+	for _, rule := range strings.Split(s, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+
+		pattern, rate, ok := strings.Cut(rule, "=")
+		count, unit, ok2 := strings.Cut(rate, "/")
+		n, err := strconv.Atoi(strings.TrimSpace(count))
+		duration, ok3 := rateUnits[strings.TrimSpace(unit)]
+		if !ok || !ok2 || !ok3 || err != nil || n <= 0 || strings.TrimSpace(pattern) == "" {
+			return nil, fmt.Errorf("invalid RATE_LIMITS rule %q, expected PATTERN=COUNT/s|m|h", rule)
+		}
+
+		limits = append(limits, rateLimit{
+			pattern: interfacePatterns{strings.TrimSpace(pattern)},
+			rate:    float64(n) / duration.Seconds(),
+			burst:   float64(n),
+		})
+	}
+
+	return limits, nil
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter keeps one token bucket per interface, and per client address
+// with -rate-limit-per-client.
+type rateLimiter struct {
+	mutex   sync.Mutex
+	limits  []rateLimit
+	buckets map[string]*tokenBucket
+}
+
+var callRateLimiter = rateLimiter{buckets: make(map[string]*tokenBucket)}
+
+func clientAddress(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+
+	return host
+}
+
+// allow takes a token for a call to iface by client. If there is none, it
+// returns false and the time until the next token is available.
+func (l *rateLimiter) allow(iface string, client string) (bool, time.Duration) {
+	var limit *rateLimit
+	for n := range l.limits {
+		if l.limits[n].pattern.match(iface) {
+			limit = &l.limits[n]
+			break
+		}
+	}
+	if limit == nil {
+		return true, 0
+	}
+
+	key := iface
+	if *rateLimitPerClient {
+		key += " " + clientAddress(client)
+	}
+
+	now := time.Now()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: limit.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(limit.burst, b.tokens+now.Sub(b.last).Seconds()*limit.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / limit.rate * float64(time.Second))
+	}
+
+	b.tokens--
+	return true, 0
+}
+
+// retryAfter formats d as a Retry-After value, in whole seconds.
+func retryAfter(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// sweep forgets buckets which have been refilled completely, and would be
+// created the same way on the next call.
+func (l *rateLimiter) sweep() {
+	now := time.Now()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > time.Hour {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// sweepPeriodically sweeps the buckets once per minute, if there are limits.
+func (l *rateLimiter) sweepPeriodically() {
+	if len(l.limits) == 0 {
+		return
+	}
+
+	go func() {
+		for range time.Tick(time.Minute) {
+			l.sweep()
+		}
+	}()
+}
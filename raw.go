@@ -0,0 +1,24 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// decodeRawCall decodes a method call from the request body, keeping its
+// parameters as the bytes sent instead of decoding them, so they are passed
+// to the service with their keys and numbers unchanged.
+func decodeRawCall(request *http.Request) (methodCall, error) {
+	var raw struct {
+		methodCall
+		Parameters json.RawMessage
+	}
+	err := decodeBody(request, &raw)
+
+	call := raw.methodCall
+	if len(raw.Parameters) > 0 && string(raw.Parameters) != "null" {
+		call.Parameters = raw.Parameters
+	}
+
+	return call, err
+}
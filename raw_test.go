@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/varlink/go/varlink"
+)
+
+// newRecordingInterface returns an interface whose method Record sends the
+// parameters it receives, as received, to parameters.
+func newRecordingInterface(parameters chan<- string) *testInterface {
+	return &testInterface{
+		name:        "org.example.recording",
+		description: "interface org.example.recording\nmethod Record(z: int, a: float, big: int, e: float, s: string, list: []float) -> ()\n",
+		methods: map[string]func(c varlink.Call) error{
+			"Record": func(c varlink.Call) error {
+				var raw json.RawMessage
+				if err := c.GetParameters(&raw); err != nil {
+					return c.ReplyInvalidParameter("parameters")
+				}
+				parameters <- string(raw)
+				return c.Reply(struct{}{})
+			},
+		},
+	}
+}
+
+func TestCallRaw(t *testing.T) {
+	parameters := make(chan string, 1)
+	startTestService(t, newTestInterface(), newRecordingInterface(parameters))
+	server := startProxy(t)
+
+	// keys out of order, and numbers which decoding and encoding again
+	// would change
+	crafted := `{"z":1,"a":1.50,"big":123456789012345678901234567890,"e":1E+3,"s":"\u00e9\u0041","list":[0.10,-0.0,2e-7]}`
+	body := `{"method": "org.example.recording.Record", "parameters": ` + crafted + `}`
+
+	response, reply := post(t, server.URL+"/?raw=true", body)
+	checkStatus(t, response, reply, http.StatusOK)
+	if got := <-parameters; got != crafted {
+		t.Errorf("service received\n%s\nexpected\n%s", got, crafted)
+	}
+
+	// with whitespace, which is not kept by the varlink message encoding
+	indented := strings.NewReplacer(",", ", ", ":", ": ").Replace(crafted)
+	response, reply = post(t, server.URL+"/?raw=true", `{"method": "org.example.recording.Record", "parameters": `+indented+`}`)
+	checkStatus(t, response, reply, http.StatusOK)
+	if got := <-parameters; got != crafted {
+		t.Errorf("service received\n%s\nexpected\n%s", got, crafted)
+	}
+
+	// without raw, the parameters are decoded and their keys sorted
+	response, reply = post(t, server.URL+"/", body)
+	checkStatus(t, response, reply, http.StatusOK)
+	if got := <-parameters; got == crafted {
+		t.Errorf("parameters were passed unchanged without raw, the test does not prove anything")
+	}
+}
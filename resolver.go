@@ -0,0 +1,194 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/varlink/go/varlink"
+)
+
+// sharedResolver is a resolver connection shared by all requests. It is
+// opened on first use and reopened after a connection error.
+type sharedResolver struct {
+	mutex    sync.Mutex
+	resolver *varlink.Resolver
+}
+
+var resolver sharedResolver
+
+var resolverAddress = flag.String("resolver-address", varlink.ResolverAddress, "`address` of the varlink resolver")
+
+var infoCacheTTL = flag.Duration("info-cache-ttl", 10*time.Second, "cache the resolver information shown on the index page for `duration` (0 disables)")
+
+// resolverInfo is the information about the resolver and the interfaces it
+// knows about.
+type resolverInfo struct {
+	Vendor     string   `json:"vendor"`
+	Product    string   `json:"product"`
+	Version    string   `json:"version"`
+	URL        string   `json:"url"`
+	Interfaces []string `json:"interfaces"`
+}
+
+// infoCache keeps the last resolver information until it expires.
+type infoCache struct {
+	mutex   sync.Mutex
+	info    resolverInfo
+	expires time.Time
+}
+
+var resolverInfoCache infoCache
+
+// do calls f with the shared resolver. If f fails with a connection error on
+// a previously opened connection, which might have gone stale, it is retried
+// once on a new connection.
+func (s *sharedResolver) do(f func(r *varlink.Resolver) error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		reused := s.resolver != nil
+		if !reused {
+			r, err := varlink.NewResolver(*resolverAddress)
+			if err != nil {
+				return err
+			}
+			s.resolver = r
+		}
+
+		err := f(s.resolver)
+		if err == nil {
+			return nil
+		}
+
+		if _, ok := err.(*varlink.Error); ok {
+			return err
+		}
+
+		s.resolver.Close()
+		s.resolver = nil
+
+		if !reused || attempt > 0 {
+			return err
+		}
+	}
+}
+
+// resolve returns the address of the service implementing iface.
+func (s *sharedResolver) resolve(iface string) (string, error) {
+	var address string
+	err := s.do(func(r *varlink.Resolver) error {
+		var err error
+		address, err = r.Resolve(iface)
+		return err
+	})
+
+	return address, err
+}
+
+// getInfo requests information about the resolver and the interfaces it
+// knows about.
+func (s *sharedResolver) getInfo(vendor *string, product *string, version *string, url *string, interfaces *[]string) error {
+	return s.do(func(r *varlink.Resolver) error {
+		return r.GetInfo(vendor, product, version, url, interfaces)
+	})
+}
+
+// cachedInfo returns the resolver information, requesting it from the
+// resolver if the cached one expired or bypass is set. The returned
+// interface list must not be modified.
+func (s *sharedResolver) cachedInfo(bypass bool) (resolverInfo, error) {
+	cache := &resolverInfoCache
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if !bypass && time.Now().Before(cache.expires) {
+		return cache.info, nil
+	}
+
+	var info resolverInfo
+	err := s.getInfo(&info.Vendor, &info.Product, &info.Version, &info.URL, &info.Interfaces)
+	if err != nil {
+		return resolverInfo{}, err
+	}
+
+	cache.info = info
+	cache.expires = time.Now().Add(*infoCacheTTL)
+	return info, nil
+}
+
+// ping checks whether the resolver answers.
+func (s *sharedResolver) ping() error {
+	return s.do(func(r *varlink.Resolver) error {
+		return r.Ping(pingTimeout)
+	})
+}
+
+// serveHealth replies with 200 OK if the resolver answers, otherwise with
+// the error which occurred.
+func serveHealth(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		httpError(writer, request, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := resolver.ping()
+	if err != nil {
+		callError(writer, request, err)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	newEncoder(writer, request).Encode(map[string]string{"status": "ok"})
+}
+
+// serveResolve returns the address of the service implementing the
+// interface named by the URL path.
+func serveResolve(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		httpError(writer, request, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	type reply struct {
+		Interface string `json:"interface"`
+		Address   string `json:"address"`
+	}
+
+	iface := request.URL.Path[len("/resolve/"):]
+	if err := checkInterfaceName(iface); err != nil {
+		callError(writer, request, err)
+		return
+	}
+	if !interfaceAllowed(iface) {
+		varlinkError(writer, request, interfaceNotAllowed(iface), http.StatusForbidden)
+		return
+	}
+
+	address, err := resolver.resolve(iface)
+	if err != nil {
+		callError(writer, request, err)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	newEncoder(writer, request).Encode(reply{iface, address})
+}
+
+// uniqueSorted sorts names in place and removes duplicates.
+func uniqueSorted(names []string) []string {
+	sort.Strings(names)
+
+	unique := names[:0]
+	for _, name := range names {
+		if len(unique) > 0 && name == unique[len(unique)-1] {
+			continue
+		}
+		unique = append(unique, name)
+	}
+
+	return unique
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUniqueSorted(t *testing.T) {
+	for _, test := range []struct {
+		names    []string
+		expected []string
+	}{
+		{[]string{}, []string{}},
+		{[]string{"a"}, []string{"a"}},
+		{[]string{"c", "a", "b"}, []string{"a", "b", "c"}},
+		{[]string{"b", "a", "b", "a", "a"}, []string{"a", "b"}},
+		{[]string{"org.example.b", "org.example", "org.example.a.b", "org.example.a"}, []string{"org.example", "org.example.a", "org.example.a.b", "org.example.b"}},
+	} {
+		if got := uniqueSorted(append([]string{}, test.names...)); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%q: got %q, expected %q", test.names, got, test.expected)
+		}
+	}
+}
+
+func TestIndexSortsInterfaces(t *testing.T) {
+	names := []string{"org.example.test", "org.example.b", "org.example.test", "org.example.a", "org.example.b"}
+	startResolver(t, nil, names)
+	server := startProxy(t)
+
+	// twice, the second reply comes from the cache
+	for n := 0; n < 2; n++ {
+		response, body := get(t, server.URL+"/")
+		checkStatus(t, response, body, http.StatusOK)
+
+		var info resolverInfo
+		if err := json.Unmarshal([]byte(body), &info); err != nil {
+			t.Fatal(err)
+		}
+		if expected := []string{"org.example.a", "org.example.b", "org.example.test"}; !reflect.DeepEqual(info.Interfaces, expected) {
+			t.Errorf("got %q, expected %q", info.Interfaces, expected)
+		}
+	}
+
+	request := newRequest(t, http.MethodGet, server.URL+"/", "")
+	request.Header.Set("Accept", "text/html")
+	response, body := do(t, request)
+	checkStatus(t, response, body, http.StatusOK)
+	a := strings.Index(body, "org.example.a")
+	b := strings.Index(body, "org.example.b")
+	if a < 0 || b < a || strings.Count(body, ">org.example.b<") > 1 {
+		t.Errorf("index page does not list the interfaces sorted and once:\n%s", body)
+	}
+}
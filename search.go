@@ -0,0 +1,149 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// searchWorkers is the maximum number of interface descriptions fetched
+// concurrently while searching.
+const searchWorkers = 8
+
+var searchCacheTTL = flag.Duration("search-cache-ttl", time.Minute, "cache search results for `duration`")
+var searchCacheSize = flag.Int("search-cache-size", 256, "cache up to `number` search results")
+
+type searchResult struct {
+	expires    time.Time
+	interfaces []string
+}
+
+type searchCache struct {
+	mutex   sync.Mutex
+	results map[string]searchResult
+}
+
+var searches = searchCache{results: make(map[string]searchResult)}
+
+// store caches result under key. Expired results are removed, and the
+// result expiring first if the cache is still full.
+func (cache *searchCache) store(key string, result searchResult) {
+	if *searchCacheSize <= 0 {
+		return
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	now := time.Now()
+	for k, r := range cache.results {
+		if !now.Before(r.expires) {
+			delete(cache.results, k)
+		}
+	}
+
+	for len(cache.results) >= *searchCacheSize {
+		var first string
+		for k, r := range cache.results {
+			if first == "" || r.expires.Before(cache.results[first].expires) {
+				first = k
+			}
+		}
+		delete(cache.results, first)
+	}
+
+	cache.results[key] = result
+}
+
+// search returns the sorted names of all interfaces known to the resolver
+// which declare a member of the given kind and name.
+func search(kind string, name string) ([]string, error) {
+	key := kind + ":" + name
+
+	searches.mutex.Lock()
+	result, ok := searches.results[key]
+	searches.mutex.Unlock()
+	if ok && time.Now().Before(result.expires) {
+		return result.interfaces, nil
+	}
+
+	var names []string
+	err := resolver.getInfo(nil, nil, nil, nil, &names)
+	if err != nil {
+		return nil, err
+	}
+
+	queue := make(chan string)
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	found := make([]string, 0)
+
+	for w := 0; w < searchWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for iface := range queue {
+				i, err := interfaces.describe(iface)
+				if err != nil {
+					log.Printf("search: skipping interface %s: %s", iface, err)
+					continue
+				}
+				if interfaceMember(i, kind, name) != nil {
+					mutex.Lock()
+					found = append(found, iface)
+					mutex.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, iface := range allowedInterfaces(names) {
+		queue <- iface
+	}
+	close(queue)
+	wg.Wait()
+
+	sort.Strings(found)
+
+	searches.store(key, searchResult{
+		expires:    time.Now().Add(*searchCacheTTL),
+		interfaces: found,
+	})
+
+	return found, nil
+}
+
+// serveSearch returns the interfaces declaring the method, error or type
+// given in the query.
+func serveSearch(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		httpError(writer, request, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var kind, name string
+	query := request.URL.Query()
+	for _, k := range []string{"method", "error", "type"} {
+		if v := query.Get(k); v != "" {
+			kind = k
+			name = v
+			break
+		}
+	}
+	if kind == "" {
+		httpError(writer, request, "Missing method, error or type query parameter", http.StatusBadRequest)
+		return
+	}
+
+	found, err := search(kind, name)
+	if err != nil {
+		callError(writer, request, err)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	newEncoder(writer, request).Encode(found)
+}
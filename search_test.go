@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/varlink/go/varlink"
+)
+
+func TestSearch(t *testing.T) {
+	other := &testInterface{
+		name:        "org.example.other",
+		description: "interface org.example.other\nmethod Nothing() -> ()\n",
+		methods: map[string]func(c varlink.Call) error{
+			"Nothing": func(c varlink.Call) error {
+				return c.Reply(struct{}{})
+			},
+		},
+	}
+	startTestService(t, newTestInterface(), other)
+	server := startProxy(t)
+
+	for query, expected := range map[string][]string{
+		"method=Echo":    {"org.example.test"},
+		"method=Nothing": {"org.example.other", "org.example.test"},
+		"error=Failed":   {"org.example.test"},
+		"type=Item":      {"org.example.test"},
+		"method=Unknown": {},
+	} {
+		response, body := get(t, server.URL+"/search?"+query)
+		checkStatus(t, response, body, http.StatusOK)
+
+		var found []string
+		if err := json.Unmarshal([]byte(body), &found); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(found, expected) {
+			t.Errorf("%s: got %v, expected %v", query, found, expected)
+		}
+	}
+}
+
+func TestSearchResolverUnavailable(t *testing.T) {
+	setFlag(t, "resolver-address", "unix:"+filepath.Join(t.TempDir(), "resolver"))
+	server := startProxy(t)
+
+	response, body := get(t, server.URL+"/search?method=Echo")
+	checkStatus(t, response, body, http.StatusBadGateway)
+}
+
+func TestSearchCacheSize(t *testing.T) {
+	setFlag(t, "search-cache-size", "2")
+	t.Cleanup(resetState)
+
+	expires := time.Now().Add(time.Minute)
+	for n, key := range []string{"method:A", "method:B", "method:C"} {
+		searches.store(key, searchResult{expires: expires.Add(time.Duration(n) * time.Second)})
+	}
+
+	if len(searches.results) != 2 {
+		t.Errorf("got %d cached results, expected 2", len(searches.results))
+	}
+	if _, ok := searches.results["method:A"]; ok {
+		t.Errorf("the result expiring first was kept")
+	}
+}
+
+func TestSearchCacheRemovesExpired(t *testing.T) {
+	t.Cleanup(resetState)
+
+	searches.store("method:A", searchResult{expires: time.Now().Add(-time.Second)})
+	searches.store("method:B", searchResult{expires: time.Now().Add(time.Minute)})
+
+	if _, ok := searches.results["method:A"]; ok {
+		t.Errorf("expired result was kept")
+	}
+	if _, ok := searches.results["method:B"]; !ok {
+		t.Errorf("new result was not stored")
+	}
+}
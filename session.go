@@ -0,0 +1,234 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/varlink/go/varlink"
+)
+
+// sessionHeader carries a token returned by POST /session. All calls
+// carrying the same token are sent over the same backend connection, which
+// allows clients to talk to services keeping per-connection state.
+const sessionHeader = "Varlink-Session"
+
+var sessionTimeout = flag.Duration("session-timeout", 5*time.Minute, "close session connections after being idle for `duration`")
+var maxSessions = flag.Int("max-sessions", 1000, "maximum number of open sessions (0 disables the limit)")
+
+// pingTimeout limits liveness checks of idle connections.
+const pingTimeout = time.Second
+
+// session holds the backend connections of one client session, one per
+// interface and address. The mutex must be held while using a connection.
+type session struct {
+	mutex       sync.Mutex
+	connections map[string]*varlink.Connection
+	addresses   map[string]string
+	timer       *time.Timer
+	closed      bool
+}
+
+func sessionKey(iface string, address string) string {
+	if address == "" {
+		return iface
+	}
+
+	return iface + "@" + address
+}
+
+// connect returns the session's connection for iface at address, dialing it
+// with open on first use or when the previous one stopped answering.
+func (s *session) connect(iface string, address string, open func(string, string) (*varlink.Connection, string, error)) (*varlink.Connection, string, error) {
+	key := sessionKey(iface, address)
+	if c, ok := s.connections[key]; ok {
+		if c.Ping(pingTimeout) == nil {
+			return c, s.addresses[key], nil
+		}
+		s.drop(iface, address)
+	}
+
+	c, address, err := open(iface, address)
+	if err != nil {
+		return nil, "", err
+	}
+
+	s.connections[key] = c
+	s.addresses[key] = address
+	return c, address, nil
+}
+
+// drop closes and forgets the session's connection for iface at address,
+// the next call will dial a new one.
+func (s *session) drop(iface string, address string) {
+	key := sessionKey(iface, address)
+	if c, ok := s.connections[key]; ok {
+		closeConnection(c)
+		delete(s.connections, key)
+		delete(s.addresses, key)
+	}
+}
+
+type sessionStore struct {
+	mutex    sync.Mutex
+	sessions map[string]*session
+}
+
+var sessions = sessionStore{sessions: make(map[string]*session)}
+
+// open creates a session for token and returns it locked. It returns nil if
+// -max-sessions sessions are open.
+func (store *sessionStore) open(token string) *session {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if *maxSessions > 0 && len(store.sessions) >= *maxSessions {
+		return nil
+	}
+
+	s := &session{
+		connections: make(map[string]*varlink.Connection),
+		addresses:   make(map[string]string),
+	}
+	s.timer = time.AfterFunc(*sessionTimeout, func() {
+		store.remove(token, s)
+	})
+	s.mutex.Lock()
+	store.sessions[token] = s
+
+	return s
+}
+
+// lock returns the locked session for token and restarts its idle timer. It
+// returns nil if there is no such session.
+func (store *sessionStore) lock(token string) *session {
+	store.mutex.Lock()
+	s, ok := store.sessions[token]
+	if ok {
+		s.timer.Reset(*sessionTimeout)
+	}
+	store.mutex.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	s.mutex.Lock()
+	if s.closed {
+		// ended while we were waiting for it
+		s.mutex.Unlock()
+		return nil
+	}
+
+	return s
+}
+
+// end closes all connections of the session for token. It returns false if
+// there is no such session.
+func (store *sessionStore) end(token string) bool {
+	store.mutex.Lock()
+	s := store.sessions[token]
+	store.mutex.Unlock()
+
+	if s == nil {
+		return false
+	}
+
+	store.remove(token, s)
+	return true
+}
+
+// remove closes the session s and removes it from the store, unless token
+// was already reused for a newer session.
+func (store *sessionStore) remove(token string, s *session) {
+	store.mutex.Lock()
+	if store.sessions[token] == s {
+		delete(store.sessions, token)
+	}
+	store.mutex.Unlock()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.timer.Stop()
+	for key, c := range s.connections {
+		closeConnection(c)
+		delete(s.connections, key)
+		delete(s.addresses, key)
+	}
+	s.closed = true
+}
+
+// newSessionToken returns a random session token.
+func newSessionToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// serveSession opens a session with POST /session, connecting to the
+// service implementing the interface given in the body, and closes it with
+// DELETE /session/TOKEN. Calls carrying the returned token in the
+// Varlink-Session header use the session's connection.
+func serveSession(writer http.ResponseWriter, request *http.Request) {
+	token := strings.TrimPrefix(request.URL.Path, "/session")
+	token = strings.TrimPrefix(token, "/")
+
+	switch {
+	case request.Method == http.MethodPost && token == "":
+		var in struct {
+			Interface string
+			Address   string
+		}
+		if err := decodeBody(request, &in); err != nil {
+			bodyError(writer, request, err)
+			return
+		}
+
+		token, err := newSessionToken()
+		if err != nil {
+			callError(writer, request, err)
+			return
+		}
+
+		s := sessions.open(token)
+		if s == nil {
+			httpError(writer, request, "Too many sessions", http.StatusServiceUnavailable)
+			return
+		}
+		_, address, err := s.connect(in.Interface, in.Address, connect)
+		s.mutex.Unlock()
+		if err != nil {
+			sessions.end(token)
+			callError(writer, request, err)
+			return
+		}
+
+		type reply struct {
+			Session   string `json:"session"`
+			Interface string `json:"interface"`
+			Address   string `json:"address"`
+		}
+		writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+		writer.Header().Set("Location", *basePath+"/session/"+token)
+		writer.WriteHeader(http.StatusCreated)
+		newEncoder(writer, request).Encode(reply{token, in.Interface, address})
+
+	case request.Method == http.MethodDelete && token != "":
+		if !sessions.end(token) {
+			httpError(writer, request, "No such session", http.StatusNotFound)
+			return
+		}
+		writer.WriteHeader(http.StatusNoContent)
+
+	default:
+		httpError(writer, request, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
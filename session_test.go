@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/varlink/go/varlink"
+)
+
+// sessionConnection returns the connection of the session for token to the
+// service implementing iface, or nil.
+func sessionConnection(token string, iface string) *varlink.Connection {
+	sessions.mutex.Lock()
+	s := sessions.sessions[token]
+	sessions.mutex.Unlock()
+	if s == nil {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.connections[sessionKey(iface, "")]
+}
+
+// openSession opens a session for org.example.test and returns its token.
+func openSession(t *testing.T, url string) string {
+	t.Helper()
+
+	response, body := post(t, url+"/session", `{"interface": "org.example.test"}`)
+	checkStatus(t, response, body, http.StatusCreated)
+
+	var reply struct {
+		Session string
+	}
+	if err := json.Unmarshal([]byte(body), &reply); err != nil {
+		t.Fatal(err)
+	}
+
+	return reply.Session
+}
+
+// sessionCall calls a method of org.example.test in the session for token.
+func sessionCall(t *testing.T, url string, token string, body string) string {
+	t.Helper()
+
+	request := newRequest(t, http.MethodPost, url, body)
+	request.Header.Set(sessionHeader, token)
+	response, reply := do(t, request)
+	checkStatus(t, response, reply, http.StatusOK)
+
+	return reply
+}
+
+func TestSessionUsesOneConnection(t *testing.T) {
+	startTestService(t)
+	server := startProxy(t)
+	token := openSession(t, server.URL)
+	other := openSession(t, server.URL)
+
+	sessionCall(t, server.URL+"/", token, `{"method": "org.example.test.Nothing"}`)
+	first := sessionConnection(token, "org.example.test")
+	if first == nil {
+		t.Fatal("session has no connection")
+	}
+
+	sessionCall(t, server.URL+"/", token, `{"method": "org.example.test.Nothing"}`)
+	if second := sessionConnection(token, "org.example.test"); second != first {
+		t.Errorf("second call of the session used another connection")
+	}
+
+	sessionCall(t, server.URL+"/", other, `{"method": "org.example.test.Nothing"}`)
+	if c := sessionConnection(other, "org.example.test"); c == first {
+		t.Errorf("another session used the same connection")
+	}
+}
+
+func TestSessionDropsConnectionWithPendingReplies(t *testing.T) {
+	startTestService(t)
+	server := startProxy(t)
+	token := openSession(t, server.URL)
+
+	// only the first of the replies is returned, the others are pending
+	reply := sessionCall(t, server.URL+"/", token, `{"method": "org.example.test.Count", "parameters": {"count": 3}, "more": true}`)
+	if expected := `{"parameters":{"i":0}}` + "\n"; reply != expected {
+		t.Errorf("got %q, expected %q", reply, expected)
+	}
+	if c := sessionConnection(token, "org.example.test"); c != nil {
+		t.Errorf("session kept the connection with pending replies")
+	}
+
+	reply = sessionCall(t, server.URL+"/", token, `{"method": "org.example.test.Echo", "parameters": {"text": "second", "number": 2}}`)
+	if expected := `{"parameters":{"number":2,"text":"second"}}` + "\n"; reply != expected {
+		t.Errorf("got %q, expected %q", reply, expected)
+	}
+}
+
+func TestSessionKeepsConnectionAfterErrorReply(t *testing.T) {
+	startTestService(t)
+	server := startProxy(t)
+	token := openSession(t, server.URL)
+
+	sessionCall(t, server.URL+"/", token, `{"method": "org.example.test.Nothing"}`)
+	first := sessionConnection(token, "org.example.test")
+
+	request := newRequest(t, http.MethodPost, server.URL+"/", `{"method": "org.example.test.Fail"}`)
+	request.Header.Set(sessionHeader, token)
+	response, body := do(t, request)
+	checkStatus(t, response, body, http.StatusBadRequest)
+
+	if c := sessionConnection(token, "org.example.test"); c != first {
+		t.Errorf("session dropped its connection after an error reply")
+	}
+}
+
+func TestSessionOpenAndEnd(t *testing.T) {
+	address := startTestService(t)
+	server := startProxy(t)
+
+	response, body := post(t, server.URL+"/session", `{"interface": "org.example.test"}`)
+	checkStatus(t, response, body, http.StatusCreated)
+
+	var reply struct {
+		Session string
+		Address string
+	}
+	if err := json.Unmarshal([]byte(body), &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Address != address {
+		t.Errorf("got address %q, expected %q", reply.Address, address)
+	}
+	if sessionConnection(reply.Session, "org.example.test") == nil {
+		t.Errorf("session has no connection")
+	}
+
+	response, body = do(t, newRequest(t, http.MethodDelete, server.URL+"/session/"+reply.Session, ""))
+	checkStatus(t, response, body, http.StatusNoContent)
+	if sessionConnection(reply.Session, "org.example.test") != nil {
+		t.Errorf("ended session still has a connection")
+	}
+
+	response, body = do(t, newRequest(t, http.MethodDelete, server.URL+"/session/"+reply.Session, ""))
+	checkStatus(t, response, body, http.StatusNotFound)
+}
+
+func TestSessionUnknownToken(t *testing.T) {
+	startTestService(t)
+	server := startProxy(t)
+
+	request := newRequest(t, http.MethodPost, server.URL+"/", `{"method": "org.example.test.Nothing"}`)
+	request.Header.Set(sessionHeader, "chosen-by-the-client")
+	response, body := do(t, request)
+	checkStatus(t, response, body, http.StatusNotFound)
+
+	sessions.mutex.Lock()
+	n := len(sessions.sessions)
+	sessions.mutex.Unlock()
+	if n != 0 {
+		t.Errorf("got %d sessions, expected none", n)
+	}
+
+	// an ended session is not opened again
+	token := openSession(t, server.URL)
+	response, body = do(t, newRequest(t, http.MethodDelete, server.URL+"/session/"+token, ""))
+	checkStatus(t, response, body, http.StatusNoContent)
+
+	request = newRequest(t, http.MethodPost, server.URL+"/", `{"method": "org.example.test.Nothing"}`)
+	request.Header.Set(sessionHeader, token)
+	response, body = do(t, request)
+	checkStatus(t, response, body, http.StatusNotFound)
+}
+
+func TestMaxSessions(t *testing.T) {
+	startTestService(t)
+	setFlag(t, "max-sessions", "2")
+	server := startProxy(t)
+
+	token := openSession(t, server.URL)
+	openSession(t, server.URL)
+
+	response, body := post(t, server.URL+"/session", `{"interface": "org.example.test"}`)
+	checkStatus(t, response, body, http.StatusServiceUnavailable)
+
+	response, body = do(t, newRequest(t, http.MethodDelete, server.URL+"/session/"+token, ""))
+	checkStatus(t, response, body, http.StatusNoContent)
+	openSession(t, server.URL)
+}
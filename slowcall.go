@@ -0,0 +1,25 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"strings"
+	"time"
+)
+
+var slowCallThreshold = flag.Duration("slow-call-threshold", 0, "log a warning for varlink calls taking longer than `duration` (0 disables)")
+
+// logSlowCall logs a warning if the call of method, which was started at
+// start, took longer than the configured slow call threshold. method may be
+// qualified with iface.
+func logSlowCall(iface string, method string, start time.Time) {
+	if *slowCallThreshold <= 0 {
+		return
+	}
+
+	duration := time.Since(start)
+	if duration > *slowCallThreshold {
+		method = strings.TrimPrefix(method, iface+".")
+		log.Printf("warning: slow call: interface=%s method=%s duration=%s", iface, method, duration)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSlowCall(t *testing.T) {
+	setFlag(t, "slow-call-threshold", "20ms")
+	startTestService(t, newTestInterface(), newSlowInterface())
+	server := startProxy(t)
+	output := captureLog(t)
+
+	response, body := post(t, server.URL+"/", `{"method": "org.example.slow.Sleep", "parameters": {"milliseconds": 0}}`)
+	checkStatus(t, response, body, http.StatusOK)
+	if strings.Contains(output.String(), "slow call") {
+		t.Errorf("fast call logged as slow:\n%s", output)
+	}
+
+	response, body = post(t, server.URL+"/", `{"method": "org.example.slow.Sleep", "parameters": {"milliseconds": 100}}`)
+	checkStatus(t, response, body, http.StatusOK)
+	if !strings.Contains(output.String(), "warning: slow call: interface=org.example.slow method=Sleep ") {
+		t.Errorf("slow call not logged:\n%s", output)
+	}
+}
+
+func TestSlowCallMethodForm(t *testing.T) {
+	setFlag(t, "slow-call-threshold", "20ms")
+	startTestService(t, newTestInterface(), newSlowInterface())
+	server := startProxy(t)
+	output := captureLog(t)
+
+	form := url.Values{"parameters": {`{"milliseconds": 100}`}}
+	request := newRequest(t, http.MethodPost, server.URL+"/interface/org.example.slow/call/Sleep", form.Encode())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response, body := do(t, request)
+	checkStatus(t, response, body, http.StatusOK)
+	if !strings.Contains(output.String(), "warning: slow call: interface=org.example.slow method=Sleep ") {
+		t.Errorf("slow call not logged:\n%s", output)
+	}
+}
+
+func TestSlowCallDisabled(t *testing.T) {
+	startTestService(t, newTestInterface(), newSlowInterface())
+	server := startProxy(t)
+	output := captureLog(t)
+
+	response, body := post(t, server.URL+"/", `{"method": "org.example.slow.Sleep", "parameters": {"milliseconds": 50}}`)
+	checkStatus(t, response, body, http.StatusOK)
+	if strings.Contains(output.String(), "slow call") {
+		t.Errorf("slow call logged without a threshold:\n%s", output)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/varlink/go/varlink"
+	"github.com/varlink/go/varlink/idl"
+)
+
+var smokeTests = flag.Bool("smoke-tests", false, "serve POST /interface/NAME/smoketest, which calls every method of the interface with default parameters")
+var smokeTestTimeout = flag.Duration("smoke-test-timeout", 5*time.Second, "maximum `duration` of each call of a smoke test")
+
+// smokeTestResult is the outcome of calling one method in a smoke test.
+type smokeTestResult struct {
+	Method   string `json:"method"`
+	Result   string `json:"result"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration,omitempty"`
+}
+
+// hasAnnotation returns true if annotations contains one called name.
+func hasAnnotation(annotations []idl.Annotation, name string) bool {
+	for _, a := range annotations {
+		if a.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// smokeTest calls method of i, as served at address or by the service
+// implementing it, with default parameters. The call is admitted like a
+// call of the client of request.
+func smokeTest(request *http.Request, i *idl.IDL, method *idl.Method, address string) smokeTestResult {
+	result := smokeTestResult{Method: method.Name}
+	if hasAnnotation(method.Annotations, "non-idempotent") {
+		result.Result = "skipped"
+		return result
+	}
+
+	iface, rejection := admit(request, i.Name+"."+method.Name)
+	if rejection != nil {
+		result.Result = "error"
+		result.Error = rejection.message
+		var verr *varlink.Error
+		if errors.As(rejection.err, &verr) {
+			result.Error = verr.Name
+		} else if rejection.err != nil {
+			result.Error = rejection.err.Error()
+		}
+		return result
+	}
+	defer callLimiter.release(iface)
+
+	start := time.Now()
+	err := func() error {
+		c, _, err := connect(i.Name, address)
+		if err != nil {
+			return err
+		}
+		// never pooled, the deadline stays set
+		defer closeConnection(c)
+
+		c.SetDeadline(start.Add(*smokeTestTimeout))
+		receive, err := c.Send(i.Name+"."+method.Name, defaultValue(i, method.In), 0)
+		if err != nil {
+			return err
+		}
+		_, err = receive(nil)
+		return err
+	}()
+	result.Duration = time.Since(start).String()
+
+	var verr *varlink.Error
+	var netErr net.Error
+	switch {
+	case err == nil:
+		result.Result = "ok"
+
+	case errors.As(err, &verr):
+		result.Result = "error"
+		result.Error = verr.Name
+
+	case errors.As(err, &netErr) && netErr.Timeout():
+		result.Result = "timeout"
+
+	default:
+		result.Result = "error"
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+// serveSmokeTest calls every method of i with default parameters, one
+// after the other, and returns which succeeded, failed or timed out.
+// Methods annotated with @non-idempotent are skipped. serveInterface only
+// calls it with -smoke-tests.
+func serveSmokeTest(writer http.ResponseWriter, request *http.Request, i *idl.IDL) {
+	if request.Method != http.MethodPost {
+		httpError(writer, request, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	type report struct {
+		Interface string            `json:"interface"`
+		Methods   []smokeTestResult `json:"methods"`
+	}
+	out := report{Interface: i.Name, Methods: make([]smokeTestResult, 0, len(i.Methods))}
+	address := request.URL.Query().Get("address")
+	for _, method := range i.Methods {
+		out.Methods = append(out.Methods, smokeTest(request, i, method, address))
+	}
+
+	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	newEncoder(writer, request).Encode(out)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// smokeTestReport runs the smoke test of org.example.test and returns the
+// results by method.
+func smokeTestReport(t *testing.T, url string) map[string]smokeTestResult {
+	t.Helper()
+
+	response, body := post(t, url+"/interface/org.example.test/smoketest", "")
+	checkStatus(t, response, body, http.StatusOK)
+
+	var report struct {
+		Interface string
+		Methods   []smokeTestResult
+	}
+	if err := json.Unmarshal([]byte(body), &report); err != nil {
+		t.Fatal(err)
+	}
+
+	results := make(map[string]smokeTestResult)
+	for _, result := range report.Methods {
+		results[result.Method] = result
+	}
+
+	return results
+}
+
+func TestSmokeTest(t *testing.T) {
+	startTestService(t)
+	setFlag(t, "smoke-tests", "true")
+	server := startProxy(t)
+
+	results := smokeTestReport(t, server.URL)
+
+	expected := map[string]string{
+		"Echo":    "ok",
+		"Count":   "ok",
+		"Nothing": "ok",
+		"Fail":    "error",
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("got %d results, expected %d: %v", len(results), len(expected), results)
+	}
+	for method, result := range results {
+		if result.Result != expected[method] {
+			t.Errorf("got %s for %s, expected %s", result.Result, method, expected[method])
+		}
+	}
+}
+
+func TestSmokeTestDisabled(t *testing.T) {
+	// no service implements the interface, the flag is checked first
+	startResolver(t, nil, nil)
+	server := startProxy(t)
+
+	response, body := post(t, server.URL+"/interface/org.example.test/smoketest", "")
+	checkStatus(t, response, body, http.StatusNotFound)
+	if strings.Contains(body, "InterfaceNotFound") {
+		t.Errorf("got %s, expected the smoke test not to be found", body)
+	}
+}
+
+func TestSmokeTestRateLimit(t *testing.T) {
+	startTestService(t)
+	setFlag(t, "smoke-tests", "true")
+	t.Setenv("RATE_LIMITS", "org.example.test=2/h")
+	server := startProxy(t)
+
+	results := smokeTestReport(t, server.URL)
+	limited := 0
+	for _, result := range results {
+		if result.Error == "Rate limit exceeded" {
+			limited++
+		}
+	}
+	if limited != 2 {
+		t.Errorf("got %d rate limited calls, expected 2: %v", limited, results)
+	}
+
+	// the rate limit applies to other calls of the client as well
+	response, body := post(t, server.URL+"/", `{"method": "org.example.test.Nothing"}`)
+	checkStatus(t, response, body, http.StatusTooManyRequests)
+}
@@ -0,0 +1,166 @@
+// Renders the OpenAPI document of the proxy, with a form to call every
+// method. The spec URL is read from the data-spec-url attribute of #docs.
+
+(function () {
+    var root = document.getElementById('docs');
+
+    function element(name, text, className) {
+        var n = document.createElement(name);
+        if (className)
+            n.classList.add(className);
+        if (text !== undefined)
+            n.appendChild(document.createTextNode(text));
+        return n;
+    }
+
+    function showError(parent, name, text) {
+        var pre = element('pre');
+        pre.appendChild(element('span', name, 'error'));
+        if (text)
+            pre.appendChild(document.createTextNode('\n' + text));
+        parent.appendChild(pre);
+    }
+
+    // example returns a value matching schema, resolving references to
+    // component schemas. Recursive references end in null.
+    function example(spec, schema, seen) {
+        seen = seen || {};
+
+        if (schema.$ref) {
+            if (seen[schema.$ref])
+                return null;
+            var name = schema.$ref.replace('#/components/schemas/', '');
+            var resolved = spec.components.schemas[name];
+            if (!resolved)
+                return null;
+            seen[schema.$ref] = true;
+            var value = example(spec, resolved, seen);
+            delete seen[schema.$ref];
+            return value;
+        }
+
+        if (schema.nullable)
+            return null;
+
+        if (schema.allOf)
+            return example(spec, schema.allOf[0], seen);
+
+        if (schema.enum)
+            return schema.enum[0];
+
+        switch (schema.type) {
+        case 'boolean':
+            return false;
+        case 'integer':
+        case 'number':
+            return 0;
+        case 'string':
+            return '';
+        case 'array':
+            return [];
+        case 'object':
+            var object = {};
+            Object.keys(schema.properties || {}).forEach(function (key) {
+                object[key] = example(spec, schema.properties[key], seen);
+            });
+            return object;
+        }
+
+        return null;
+    }
+
+    function call(url, parameters, results) {
+        results.innerHTML = '';
+
+        var body;
+        try {
+            body = JSON.stringify(JSON.parse(parameters.value || '{}'));
+            parameters.classList.remove('error');
+        } catch (err) {
+            parameters.classList.add('error');
+            showError(results, err.name, err.message);
+            return;
+        }
+
+        var request = new XMLHttpRequest();
+        request.open('POST', url);
+        request.setRequestHeader('Content-Type', 'application/json');
+        request.setRequestHeader('Accept', 'application/json');
+        request.onload = function () {
+            try {
+                var message = JSON.parse(request.responseText);
+            } catch (err) {
+                showError(results, err.name, request.responseText);
+                return;
+            }
+
+            if (message.error) {
+                showError(results, message.error, message.parameters ? JSON.stringify(message.parameters, null, 2) : '');
+                return;
+            }
+
+            results.appendChild(element('pre', JSON.stringify(message.parameters || {}, null, 2)));
+        };
+        request.onerror = function () {
+            showError(results, 'Request failed');
+        };
+        request.send(body);
+    }
+
+    function renderOperation(spec, server, path, operation) {
+        var section = element('section');
+        section.appendChild(element('h2', operation.operationId));
+        if (operation.description)
+            section.appendChild(element('p', operation.description));
+
+        var schema = operation.requestBody.content['application/json'].schema;
+        var parameters = element('textarea', JSON.stringify(example(spec, schema), null, 2), 'parameters');
+        parameters.spellcheck = false;
+        section.appendChild(parameters);
+
+        var results = element('div');
+        var button = element('button', 'Call', 'submit');
+        button.onclick = function () {
+            call(server + path, parameters, results);
+        };
+        section.appendChild(button);
+        section.appendChild(results);
+
+        return section;
+    }
+
+    function render(spec) {
+        document.title = spec.info.title;
+        root.appendChild(element('h1', spec.info.title));
+        if (spec.info.description)
+            root.appendChild(element('p', spec.info.description));
+
+        var server = spec.servers && spec.servers.length ? spec.servers[0].url : '';
+        Object.keys(spec.paths).sort().forEach(function (path) {
+            root.appendChild(renderOperation(spec, server, path, spec.paths[path].post));
+        });
+    }
+
+    var request = new XMLHttpRequest();
+    request.open('GET', root.dataset.specUrl);
+    request.setRequestHeader('Accept', 'application/json');
+    request.onload = function () {
+        try {
+            var spec = JSON.parse(request.responseText);
+        } catch (err) {
+            showError(root, err.name, request.responseText);
+            return;
+        }
+
+        if (spec.error) {
+            showError(root, spec.error, JSON.stringify(spec.parameters || {}, null, 2));
+            return;
+        }
+
+        render(spec);
+    };
+    request.onerror = function () {
+        showError(root, 'Request failed');
+    };
+    request.send();
+})();
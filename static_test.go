@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStaticFileRange(t *testing.T) {
+	server := startProxy(t)
+
+	css, err := os.ReadFile(filepath.Join(datadir, "varlink.css"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, body := getRange(t, server.URL+"/varlink.css", "bytes=0-4")
+	checkStatus(t, response, body, http.StatusPartialContent)
+	if expected := string(css[:5]); body != expected {
+		t.Errorf("got %q, expected %q", body, expected)
+	}
+	if response.Header.Get("Last-Modified") == "" || response.Header.Get("Cache-Control") == "" {
+		t.Errorf("caching headers missing: %v", response.Header)
+	}
+
+	response, body = do(t, newRequest(t, http.MethodHead, server.URL+"/favicon.ico", ""))
+	checkStatus(t, response, body, http.StatusOK)
+}
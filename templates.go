@@ -0,0 +1,52 @@
+package main
+
+import (
+	"html/template"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path"
+	"sync/atomic"
+	"syscall"
+)
+
+// templates holds the parsed template set. A template set must not be
+// parsed while it is executed, so reloading parses a new set and swaps it
+// in atomically.
+var templates atomic.Pointer[template.Template]
+
+func loadTemplates() error {
+	t := template.New("").Funcs(template.FuncMap{
+		// base returns the path all pages are served below
+		"base": func() string { return *basePath },
+	})
+	t, err := t.ParseGlob(path.Join(datadir, "*.html"))
+	if err != nil {
+		return err
+	}
+
+	templates.Store(t)
+	return nil
+}
+
+func executeTemplate(writer io.Writer, name string, data interface{}) error {
+	return templates.Load().ExecuteTemplate(writer, name, data)
+}
+
+// reloadTemplatesOnHangup reloads the templates whenever the process
+// receives SIGHUP.
+func reloadTemplatesOnHangup() {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	go func() {
+		for range hangup {
+			if err := loadTemplates(); err != nil {
+				log.Printf("reloading templates: %s", err)
+				continue
+			}
+			log.Print("reloaded templates")
+		}
+	}()
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestReloadWhileServing requests pages while the templates are reloaded,
+// and the resolver connection and cached descriptions are dropped.
+func TestReloadWhileServing(t *testing.T) {
+	startTestService(t)
+	server := startProxy(t)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if err := loadTemplates(); err != nil {
+				t.Error(err)
+				return
+			}
+			resetState()
+		}
+	}()
+
+	for i := 0; i < 4; i++ {
+		path := []string{"/", "/interface/org.example.test"}[i%2]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 20; n++ {
+				request := newRequest(t, http.MethodGet, server.URL+path, "")
+				request.Header.Set("Accept", "text/html")
+				response, err := http.DefaultClient.Do(request)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				response.Body.Close()
+				if response.StatusCode != http.StatusOK {
+					t.Errorf("%s: got status %d", path, response.StatusCode)
+				}
+			}
+		}()
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	close(done)
+	wg.Wait()
+}
+
+func TestReloadTemplatesOnHangup(t *testing.T) {
+	dir := t.TempDir()
+	files, err := filepath.Glob(filepath.Join(datadir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, filepath.Base(file)), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	old := datadir
+	datadir = dir
+	t.Cleanup(func() {
+		datadir = old
+		loadTemplates()
+	})
+
+	startTestService(t)
+	server := startProxy(t)
+	reloadTemplatesOnHangup()
+
+	index := filepath.Join(dir, "index.html")
+	b, err := os.ReadFile(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(index, []byte(strings.Replace(string(b), "<body>", "<body>reloaded", 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		request := newRequest(t, http.MethodGet, server.URL+"/", "")
+		request.Header.Set("Accept", "text/html")
+		response, body := do(t, request)
+		checkStatus(t, response, body, http.StatusOK)
+		if strings.Contains(body, "<body>reloaded") {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("templates were not reloaded:\n%s", body)
+		}
+	}
+}
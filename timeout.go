@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// withTimeout replies with 504 Gateway Timeout to requests which are not
+// handled within timeout. Streamed replies are not buffered and therefore
+// exempt.
+func withTimeout(timeout time.Duration, handler http.Handler) http.Handler {
+	body, _ := json.Marshal(errorBody{
+		Error:      errorName("org.varlink.http.Timeout"),
+		Parameters: map[string]string{"message": "Request timed out"},
+	})
+	timeoutHandler := http.TimeoutHandler(handler, timeout, string(body))
+
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if wantsEventStream(request) {
+			handler.ServeHTTP(writer, request)
+			return
+		}
+
+		timeoutHandler.ServeHTTP(timeoutReplyWriter{writer}, request)
+	})
+}
+
+// timeoutReplyWriter sets the status and content type of the timeout reply,
+// which http.TimeoutHandler sends as 503 without a content type. Replies of
+// the handler keep the status and headers it set.
+type timeoutReplyWriter struct {
+	http.ResponseWriter
+}
+
+func (w timeoutReplyWriter) WriteHeader(status int) {
+	if status == http.StatusServiceUnavailable && w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		status = http.StatusGatewayTimeout
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveWithTimeout serves a GET request for path with handler wrapped by
+// withTimeout.
+func serveWithTimeout(timeout time.Duration, handler http.HandlerFunc, path string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	withTimeout(timeout, handler).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+
+	return recorder
+}
+
+func TestTimeoutReply(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	recorder := serveWithTimeout(10*time.Millisecond, func(writer http.ResponseWriter, request *http.Request) {
+		<-done
+	}, "/")
+
+	if recorder.Code != http.StatusGatewayTimeout {
+		t.Fatalf("got status %d, expected 504", recorder.Code)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "application/json; charset=utf-8" {
+		t.Errorf("got Content-Type %q, expected JSON", contentType)
+	}
+
+	var body errorBody
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Error != "org.varlink.http.Timeout" {
+		t.Errorf("got error %q, expected org.varlink.http.Timeout", body.Error)
+	}
+}
+
+func TestTimeoutKeepsContentType(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		handler     http.HandlerFunc
+		status      int
+		contentType string
+	}{
+		{"no content", func(writer http.ResponseWriter, request *http.Request) {
+			writer.WriteHeader(http.StatusNoContent)
+		}, http.StatusNoContent, ""},
+		{"redirect", func(writer http.ResponseWriter, request *http.Request) {
+			http.Redirect(writer, request, "/other", http.StatusMovedPermanently)
+		}, http.StatusMovedPermanently, "text/html; charset=utf-8"},
+		{"html", func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+			io.WriteString(writer, "<html></html>")
+		}, http.StatusOK, "text/html; charset=utf-8"},
+		{"plain", func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(writer, "unavailable")
+		}, http.StatusServiceUnavailable, "text/plain; charset=utf-8"},
+	} {
+		recorder := serveWithTimeout(time.Minute, test.handler, "/")
+		if recorder.Code != test.status {
+			t.Errorf("%s: got status %d, expected %d", test.name, recorder.Code, test.status)
+		}
+		if contentType := recorder.Header().Get("Content-Type"); contentType != test.contentType {
+			t.Errorf("%s: got Content-Type %q, expected %q", test.name, contentType, test.contentType)
+		}
+	}
+}
+
+func TestSlowCallTimeout(t *testing.T) {
+	setFlag(t, "request-timeout", "50ms")
+	startTestService(t, newTestInterface(), newSlowInterface())
+	server := startProxy(t)
+
+	response, body := post(t, server.URL+"/", `{"method": "org.example.slow.Sleep", "parameters": {"milliseconds": 500}}`)
+	checkStatus(t, response, body, http.StatusGatewayTimeout)
+	if !strings.Contains(body, "org.varlink.http.Timeout") {
+		t.Errorf("got %s, expected org.varlink.http.Timeout", body)
+	}
+
+	response, body = post(t, server.URL+"/", `{"method": "org.example.slow.Sleep", "parameters": {"milliseconds": 0}}`)
+	checkStatus(t, response, body, http.StatusOK)
+}
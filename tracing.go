@@ -0,0 +1,441 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Spans are exported with the OpenTelemetry protocol over HTTP, in its JSON
+// encoding, to the endpoint given in the standard OTEL_EXPORTER_OTLP_*
+// environment variables. Without an endpoint, tracing is disabled and the
+// handlers are not wrapped at all.
+
+const (
+	spanKindServer = 2
+	spanKindClient = 3
+
+	spanStatusError = 2
+
+	maxExportBatch = 512
+	maxSpanQueue   = 2048
+)
+
+type spanAttribute struct {
+	key   string
+	value interface{}
+}
+
+// span is one OpenTelemetry span. Methods of a nil span do nothing, it is
+// returned if tracing is disabled.
+type span struct {
+	exporter *spanExporter
+	name     string
+	kind     int
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	sampled  bool
+	start    time.Time
+	end      time.Time
+
+	attributes []spanAttribute
+	status     string
+}
+
+type spanKey struct{}
+
+// parseTraceparent returns the trace ID, parent span ID and sampled flag of
+// a W3C traceparent header. ok is false if the header is missing or
+// invalid, the span then starts a new trace.
+func parseTraceparent(header string) (traceID [16]byte, parentID [8]byte, sampled bool, ok bool) {
+	parts := strings.Split(header, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return traceID, parentID, false, false
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 || strings.ToLower(header) != header {
+		return traceID, parentID, false, false
+	}
+
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return traceID, parentID, false, false
+	}
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil || traceID == [16]byte{} {
+		return traceID, parentID, false, false
+	}
+	if _, err := hex.Decode(parentID[:], []byte(parts[2])); err != nil || parentID == [8]byte{} {
+		return traceID, parentID, false, false
+	}
+
+	return traceID, parentID, flags[0]&1 != 0, true
+}
+
+// startChildSpan starts a span below the span of the request context. It
+// returns nil if the request is not traced.
+func startChildSpan(ctx context.Context, name string, kind int) *span {
+	parent, _ := ctx.Value(spanKey{}).(*span)
+	if parent == nil {
+		return nil
+	}
+
+	s := &span{
+		exporter: parent.exporter,
+		name:     name,
+		kind:     kind,
+		traceID:  parent.traceID,
+		parentID: parent.spanID,
+		sampled:  parent.sampled,
+		start:    time.Now(),
+	}
+	rand.Read(s.spanID[:])
+
+	return s
+}
+
+func (s *span) setAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+
+	s.attributes = append(s.attributes, spanAttribute{key, value})
+}
+
+// setError marks the span as failed with err.
+func (s *span) setError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.status = err.Error()
+}
+
+// finish ends the span and queues it for export. Spans are dropped if the
+// queue is full.
+func (s *span) finish() {
+	if s == nil || !s.sampled {
+		return
+	}
+
+	s.end = time.Now()
+	select {
+	case s.exporter.spans <- s:
+	default:
+	}
+}
+
+// withTracing starts a server span for every request, continuing the trace
+// of its traceparent header. Calls started by the request are recorded as
+// child spans.
+func withTracing(exporter *spanExporter, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		s := &span{
+			exporter: exporter,
+			name:     request.Method,
+			kind:     spanKindServer,
+			sampled:  true,
+			start:    time.Now(),
+		}
+		if traceID, parentID, sampled, ok := parseTraceparent(request.Header.Get("traceparent")); ok {
+			s.traceID, s.parentID, s.sampled = traceID, parentID, sampled
+		} else {
+			rand.Read(s.traceID[:])
+		}
+		rand.Read(s.spanID[:])
+
+		s.setAttribute("http.request.method", request.Method)
+		s.setAttribute("url.path", request.URL.Path)
+		s.setAttribute("client.address", clientAddress(request.RemoteAddr))
+
+		w := &statusWriter{ResponseWriter: writer}
+		handler.ServeHTTP(w, request.WithContext(context.WithValue(request.Context(), spanKey{}, s)))
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+
+		s.setAttribute("http.response.status_code", w.status)
+		if w.status >= 500 {
+			s.status = http.StatusText(w.status)
+		}
+		s.finish()
+	})
+}
+
+// spanExporter sends finished spans to an OTLP/HTTP endpoint in batches.
+type spanExporter struct {
+	endpoint    string
+	headers     map[string]string
+	serviceName string
+	delay       time.Duration
+	client      *http.Client
+
+	spans   chan *span
+	quit    chan struct{}
+	stopped chan struct{}
+}
+
+// tracingExporter is the exporter of the current handler, nil if tracing is
+// disabled.
+var tracingExporter *spanExporter
+
+// environment returns the value of the first of the variables which is set.
+func environment(names ...string) string {
+	for _, name := range names {
+		if value, ok := os.LookupEnv(name); ok {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// newSpanExporter returns an exporter configured by the OTEL_* environment
+// variables, or nil if no endpoint is set or tracing is disabled.
+func newSpanExporter() (*spanExporter, error) {
+	if os.Getenv("OTEL_SDK_DISABLED") == "true" {
+		return nil, nil
+	}
+	if exporter := os.Getenv("OTEL_TRACES_EXPORTER"); exporter != "" && exporter != "otlp" {
+		return nil, nil
+	}
+
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+		}
+	}
+	if endpoint == "" {
+		return nil, nil
+	}
+
+	if protocol := environment("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", "OTEL_EXPORTER_OTLP_PROTOCOL"); protocol != "" && protocol != "http/json" {
+		return nil, fmt.Errorf("unsupported OTLP protocol %q, only http/json is supported", protocol)
+	}
+
+	headers := make(map[string]string)
+	for _, header := range strings.Split(environment("OTEL_EXPORTER_OTLP_TRACES_HEADERS", "OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		name, value, ok := strings.Cut(header, "=")
+		if !ok {
+			continue
+		}
+		if unescaped, err := url.QueryUnescape(strings.TrimSpace(value)); err == nil {
+			value = unescaped
+		}
+		headers[strings.TrimSpace(name)] = value
+	}
+
+	timeout := 10 * time.Second
+	if ms, err := strconv.Atoi(environment("OTEL_EXPORTER_OTLP_TRACES_TIMEOUT", "OTEL_EXPORTER_OTLP_TIMEOUT")); err == nil && ms > 0 {
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+
+	delay := 5 * time.Second
+	if ms, err := strconv.Atoi(os.Getenv("OTEL_BSP_SCHEDULE_DELAY")); err == nil && ms > 0 {
+		delay = time.Duration(ms) * time.Millisecond
+	}
+
+	name := os.Getenv("OTEL_SERVICE_NAME")
+	if name == "" {
+		name = *serviceName
+	}
+
+	return &spanExporter{
+		endpoint:    endpoint,
+		headers:     headers,
+		serviceName: name,
+		delay:       delay,
+		client:      &http.Client{Timeout: timeout},
+		spans:       make(chan *span, maxSpanQueue),
+		quit:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}, nil
+}
+
+// run exports the queued spans every schedule delay, or whenever a batch
+// is full, until stop is called.
+func (e *spanExporter) run() {
+	defer close(e.stopped)
+
+	ticker := time.NewTicker(e.delay)
+	defer ticker.Stop()
+
+	var batch []*span
+	for {
+		select {
+		case s := <-e.spans:
+			batch = append(batch, s)
+			if len(batch) < maxExportBatch {
+				continue
+			}
+
+		case <-ticker.C:
+
+		case <-e.quit:
+			for len(e.spans) > 0 {
+				batch = append(batch, <-e.spans)
+			}
+			e.export(batch)
+			return
+		}
+
+		e.export(batch)
+		batch = nil
+	}
+}
+
+// stop exports the remaining spans and stops the exporter.
+func (e *spanExporter) stop() {
+	close(e.quit)
+	<-e.stopped
+}
+
+// startTracing replaces the exporter of a previous handler with one
+// configured by the environment, and starts it.
+func startTracing() error {
+	if tracingExporter != nil {
+		tracingExporter.stop()
+		tracingExporter = nil
+	}
+
+	exporter, err := newSpanExporter()
+	if err != nil || exporter == nil {
+		return err
+	}
+
+	tracingExporter = exporter
+	go exporter.run()
+	return nil
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+func otlpAttributes(attributes []spanAttribute) []otlpAttribute {
+	out := make([]otlpAttribute, 0, len(attributes))
+	for _, a := range attributes {
+		var value otlpValue
+		switch v := a.value.(type) {
+		case int:
+			// 64 bit integers are strings in the JSON encoding
+			s := strconv.Itoa(v)
+			value.IntValue = &s
+		default:
+			s := fmt.Sprint(v)
+			value.StringValue = &s
+		}
+		out = append(out, otlpAttribute{a.key, value})
+	}
+
+	return out
+}
+
+// export sends batch to the endpoint. Failures are logged, the spans are
+// dropped.
+func (e *spanExporter) export(batch []*span) {
+	if len(batch) == 0 {
+		return
+	}
+
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, s := range batch {
+		out := otlpSpan{
+			TraceID:           hex.EncodeToString(s.traceID[:]),
+			SpanID:            hex.EncodeToString(s.spanID[:]),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.attributes),
+		}
+		if s.parentID != [8]byte{} {
+			out.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+		if s.status != "" {
+			out.Status = &otlpStatus{Code: spanStatusError, Message: s.status}
+		}
+		spans = append(spans, out)
+	}
+
+	type scope struct {
+		Name    string `json:"name"`
+		Version string `json:"version,omitempty"`
+	}
+	type scopeSpans struct {
+		Scope scope      `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	type resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+	type resourceSpans struct {
+		Resource   resource     `json:"resource"`
+		ScopeSpans []scopeSpans `json:"scopeSpans"`
+	}
+	body, err := json.Marshal(struct {
+		ResourceSpans []resourceSpans `json:"resourceSpans"`
+	}{
+		[]resourceSpans{{
+			Resource:   resource{otlpAttributes([]spanAttribute{{"service.name", e.serviceName}})},
+			ScopeSpans: []scopeSpans{{scope{"org.varlink.http", getBuildInfo().Version}, spans}},
+		}},
+	})
+	if err != nil {
+		log.Printf("exporting spans: %s", err)
+		return
+	}
+
+	request, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("exporting spans: %s", err)
+		return
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range e.headers {
+		request.Header.Set(name, value)
+	}
+
+	response, err := e.client.Do(request)
+	if err != nil {
+		log.Printf("exporting spans: %s", err)
+		return
+	}
+	response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		log.Printf("exporting spans: %s replied %s", e.endpoint, response.Status)
+	}
+}
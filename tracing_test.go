@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type exportedSpan struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Name         string
+	Kind         int
+	Attributes   []struct {
+		Key   string
+		Value struct {
+			StringValue string
+			IntValue    string
+		}
+	}
+	Status *struct {
+		Code int
+	}
+}
+
+// attribute returns the value of the attribute key of s.
+func (s exportedSpan) attribute(key string) string {
+	for _, a := range s.Attributes {
+		if a.Key == key {
+			return a.Value.StringValue + a.Value.IntValue
+		}
+	}
+
+	return ""
+}
+
+// startCollector receives spans exported by the proxy until the test ends,
+// and returns a channel of them. The service name of each export is sent
+// to services.
+func startCollector(t *testing.T, services chan<- string) <-chan exportedSpan {
+	t.Helper()
+
+	spans := make(chan exportedSpan, 100)
+	collector := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path != "/v1/traces" || request.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got %s %s", request.URL.Path, request.Header.Get("Content-Type"))
+		}
+
+		var export struct {
+			ResourceSpans []struct {
+				Resource struct {
+					Attributes []struct {
+						Key   string
+						Value struct{ StringValue string }
+					}
+				}
+				ScopeSpans []struct {
+					Spans []exportedSpan
+				}
+			}
+		}
+		body, _ := io.ReadAll(request.Body)
+		if err := json.Unmarshal(body, &export); err != nil {
+			t.Errorf("%s: %s", err, body)
+		}
+		for _, r := range export.ResourceSpans {
+			if services != nil && len(r.Resource.Attributes) > 0 {
+				services <- r.Resource.Attributes[0].Key + "=" + r.Resource.Attributes[0].Value.StringValue
+			}
+			for _, s := range r.ScopeSpans {
+				for _, span := range s.Spans {
+					spans <- span
+				}
+			}
+		}
+	}))
+	t.Cleanup(collector.Close)
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", collector.URL+"/")
+	t.Setenv("OTEL_BSP_SCHEDULE_DELAY", "10")
+
+	return spans
+}
+
+func receiveSpan(t *testing.T, spans <-chan exportedSpan) exportedSpan {
+	t.Helper()
+
+	select {
+	case s := <-spans:
+		return s
+	case <-time.After(5 * time.Second):
+		t.Fatal("no span was exported")
+	}
+
+	return exportedSpan{}
+}
+
+func TestTracing(t *testing.T) {
+	startTestService(t)
+	services := make(chan string, 10)
+	spans := startCollector(t, services)
+	t.Setenv("OTEL_SERVICE_NAME", "proxy")
+	server := startProxy(t)
+
+	request := newRequest(t, http.MethodPost, server.URL+"/", `{"method": "org.example.test.Echo", "parameters": {"text": "a", "number": 1}}`)
+	request.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	response, body := do(t, request)
+	checkStatus(t, response, body, http.StatusOK)
+
+	// the call ends before the request
+	call := receiveSpan(t, spans)
+	handler := receiveSpan(t, spans)
+
+	if handler.TraceID != "0af7651916cd43dd8448eb211c80319c" || handler.ParentSpanID != "b7ad6b7169203331" {
+		t.Errorf("request span does not continue the trace: %+v", handler)
+	}
+	if handler.Kind != spanKindServer || handler.attribute("http.request.method") != "POST" || handler.attribute("http.response.status_code") != "200" {
+		t.Errorf("got request span %+v", handler)
+	}
+
+	if call.TraceID != handler.TraceID || call.ParentSpanID != handler.SpanID || call.SpanID == handler.SpanID {
+		t.Errorf("call span is not a child of the request span: %+v", call)
+	}
+	if call.Kind != spanKindClient || call.Name != "org.example.test.Echo" ||
+		call.attribute("rpc.system") != "varlink" || call.attribute("rpc.service") != "org.example.test" ||
+		call.attribute("rpc.method") != "Echo" || call.attribute("server.address") == "" {
+		t.Errorf("got call span %+v", call)
+	}
+	if call.Status != nil {
+		t.Errorf("successful call has status %+v", call.Status)
+	}
+
+	if service := <-services; service != "service.name=proxy" {
+		t.Errorf("got resource %s", service)
+	}
+}
+
+func TestTracingErrors(t *testing.T) {
+	startTestService(t)
+	spans := startCollector(t, nil)
+	server := startProxy(t)
+
+	response, body := post(t, server.URL+"/", `{"method": "org.example.test.Fail"}`)
+	checkStatus(t, response, body, http.StatusBadRequest)
+
+	call := receiveSpan(t, spans)
+	handler := receiveSpan(t, spans)
+	if call.Status == nil || call.Status.Code != spanStatusError {
+		t.Errorf("failed call has status %+v", call.Status)
+	}
+	if handler.ParentSpanID != "" || len(handler.TraceID) != 32 {
+		t.Errorf("request without traceparent does not start a trace: %+v", handler)
+	}
+	// errors caused by the client are no errors of the proxy
+	if handler.Status != nil {
+		t.Errorf("request span has status %+v", handler.Status)
+	}
+}
+
+func TestTracingNotSampled(t *testing.T) {
+	startTestService(t)
+	spans := startCollector(t, nil)
+	server := startProxy(t)
+
+	request := newRequest(t, http.MethodPost, server.URL+"/", `{"method": "org.example.test.Nothing"}`)
+	request.Header.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00")
+	response, body := do(t, request)
+	checkStatus(t, response, body, http.StatusOK)
+
+	// spans are exported in order, the ones of this request come first
+	request.Header.Set("traceparent", "00-11111111111111111111111111111111-b7ad6b7169203331-01")
+	response, body = do(t, request)
+	checkStatus(t, response, body, http.StatusOK)
+
+	for n := 0; n < 2; n++ {
+		if s := receiveSpan(t, spans); s.TraceID != "11111111111111111111111111111111" {
+			t.Errorf("exported span %+v of a trace which is not sampled", s)
+		}
+	}
+}
+
+func TestTracingDisabled(t *testing.T) {
+	startTestService(t)
+	startProxy(t)
+
+	if tracingExporter != nil {
+		t.Error("tracing is enabled without an endpoint")
+	}
+}
+
+func TestTracingProtocol(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:4318")
+	t.Setenv("OTEL_EXPORTER_OTLP_PROTOCOL", "grpc")
+
+	if _, err := newHandler(); err == nil {
+		t.Error("expected an error for the grpc protocol")
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	for _, test := range []struct {
+		header  string
+		sampled bool
+		ok      bool
+	}{
+		{"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", true, true},
+		{"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00", false, true},
+		{"01-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-03-future", true, true},
+		{"", false, false},
+		{"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01-extra", false, false},
+		{"ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", false, false},
+		{"00-00000000000000000000000000000000-b7ad6b7169203331-01", false, false},
+		{"00-0af7651916cd43dd8448eb211c80319c-0000000000000000-01", false, false},
+		{"00-0AF7651916CD43DD8448EB211C80319C-b7ad6b7169203331-01", false, false},
+		{"00-0af7651916cd43dd8448eb211c80319-b7ad6b7169203331-01", false, false},
+		{"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-zz", false, false},
+	} {
+		_, _, sampled, ok := parseTraceparent(test.header)
+		if ok != test.ok || sampled != test.sampled {
+			t.Errorf("%q: got sampled %v, ok %v", test.header, sampled, ok)
+		}
+	}
+}
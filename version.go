@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// version and commit can be set at build time with
+// -ldflags "-X main.version=... -X main.commit=...". Otherwise, they are
+// taken from the build information embedded by the go tool, if available.
+var version string
+var commit string
+
+var printVersion = flag.Bool("version", false, "print version information and exit")
+
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	GoVersion string `json:"goVersion"`
+}
+
+func getBuildInfo() buildInfo {
+	b := buildInfo{
+		Version:   version,
+		Commit:    commit,
+		GoVersion: runtime.Version(),
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if b.Version == "" {
+			b.Version = info.Main.Version
+		}
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" && b.Commit == "" {
+				b.Commit = setting.Value
+			}
+		}
+	}
+
+	if b.Version == "" {
+		b.Version = "unknown"
+	}
+	if b.Commit == "" {
+		b.Commit = "unknown"
+	}
+
+	return b
+}
+
+func serveVersion(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		httpError(writer, request, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	newEncoder(writer, request).Encode(getBuildInfo())
+}